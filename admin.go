@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// parseAdminIDs разбирает TELEGRAM_ADMINS (id пользователей через запятую) в
+// множество администраторов бота.
+func parseAdminIDs(raw string) map[int64]bool {
+	admins := make(map[int64]bool)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			log.Printf("Пропущен некорректный id администратора %q: %v", part, err)
+			continue
+		}
+		admins[id] = true
+	}
+	return admins
+}
+
+// isAdmin сообщает, может ли пользователь userID использовать административные команды.
+func isAdmin(app *App, userID int64) bool {
+	return app.Admins[userID]
+}
+
+// Обработка команды /reload — перечитывает все темы из quizzesDir без
+// перезапуска процесса.
+func handleReload(ctx *Context) error {
+	if !isAdmin(ctx.App, ctx.UserID) {
+		return ctx.Send("Команда доступна только администраторам.")
+	}
+
+	if err := ctx.App.QuestionMgr.Reload(quizzesDir); err != nil {
+		return fmt.Errorf("ошибка перезагрузки тем: %w", err)
+	}
+
+	return ctx.Send(fmt.Sprintf("Темы перезагружены: %d шт.", len(ctx.App.QuestionMgr.ThemeNames())))
+}
+
+// Обработка команды /themes — список загруженных тем с числом вопросов в каждой.
+func handleThemes(ctx *Context) error {
+	if !isAdmin(ctx.App, ctx.UserID) {
+		return ctx.Send("Команда доступна только администраторам.")
+	}
+
+	counts := ctx.App.QuestionMgr.ThemeCounts()
+	if len(counts) == 0 {
+		return ctx.Send("Темы не загружены.")
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	text := "Загруженные темы:\n"
+	for _, name := range names {
+		text += fmt.Sprintf("%s — %d вопрос(ов)\n", name, counts[name])
+	}
+	return ctx.Send(text)
+}
+
+// sanitizeUploadFilename проверяет и очищает имя файла, присланного командой
+// /upload: filepath.Base отбрасывает любые directory traversal сегменты
+// (например, "../../evil.json"), присланные в имени документа, не давая
+// записать файл за пределы quizzesDir.
+func sanitizeUploadFilename(name string) (string, bool) {
+	base := filepath.Base(name)
+	if base == "" || base == "." || base == ".." || strings.ToLower(filepath.Ext(base)) != ".json" {
+		return "", false
+	}
+	return base, true
+}
+
+// Обработка команды /upload — принимает JSON-файл темы, присланный документом,
+// валидирует его и сохраняет в quizzesDir, после чего перезагружает темы.
+func handleUpload(ctx *Context) error {
+	if !isAdmin(ctx.App, ctx.UserID) {
+		return ctx.Send("Команда доступна только администраторам.")
+	}
+
+	doc := ctx.Update.Message.Document
+	if doc == nil {
+		return ctx.Send("Прикрепите JSON-файл темы как документ к команде /upload.")
+	}
+
+	fileName, ok := sanitizeUploadFilename(doc.FileName)
+	if !ok {
+		return ctx.Send("Ожидается файл с расширением .json.")
+	}
+
+	url, err := ctx.App.Bot.GetFileDirectURL(doc.FileID)
+	if err != nil {
+		return fmt.Errorf("ошибка получения ссылки на файл: %w", err)
+	}
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return fmt.Errorf("ошибка загрузки файла: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+
+	destPath := filepath.Join(quizzesDir, fileName)
+
+	// Валидация во временный файл перед записью на место: если содержимое не
+	// проходит loadQuestionFile, destPath не трогаем и ничего в quizzesDir не
+	// остаётся.
+	tmpPath := destPath + ".upload.tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return fmt.Errorf("ошибка сохранения файла %s: %w", tmpPath, err)
+	}
+
+	title, questions, err := loadQuestionFile(tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return ctx.Send(fmt.Sprintf("Файл %s отклонён: %v", fileName, err))
+	}
+
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("ошибка сохранения файла %s: %w", destPath, err)
+	}
+
+	if err := ctx.App.QuestionMgr.Reload(quizzesDir); err != nil {
+		return fmt.Errorf("файл %s сохранён, но перезагрузка тем завершилась ошибкой: %w", fileName, err)
+	}
+
+	return ctx.Send(fmt.Sprintf("Файл %s сохранён: тема %q, %d вопрос(ов). Темы перезагружены: %d шт.",
+		fileName, title, len(questions), len(ctx.App.QuestionMgr.ThemeNames())))
+}
+
+// Обработка команды /broadcast <текст> — рассылает сообщение всем известным
+// пользователям.
+func handleBroadcast(ctx *Context) error {
+	if !isAdmin(ctx.App, ctx.UserID) {
+		return ctx.Send("Команда доступна только администраторам.")
+	}
+
+	text := strings.TrimSpace(ctx.Update.Message.CommandArguments())
+	if text == "" {
+		return ctx.Send("Использование: /broadcast <текст>")
+	}
+
+	userIDs, err := ctx.App.Store.KnownUserIDs()
+	if err != nil {
+		return fmt.Errorf("ошибка чтения списка пользователей: %w", err)
+	}
+
+	sent := 0
+	for _, userID := range userIDs {
+		if _, err := ctx.App.Bot.Send(tgbotapi.NewMessage(userID, text)); err != nil {
+			log.Printf("Ошибка рассылки пользователю %d: %v", userID, err)
+			continue
+		}
+		sent++
+	}
+
+	return ctx.Send(fmt.Sprintf("Рассылка отправлена %d из %d пользователей.", sent, len(userIDs)))
+}
+
+// Обработка команды /stats_global — суммарная точность ответов по всем пользователям.
+func handleStatsGlobal(ctx *Context) error {
+	if !isAdmin(ctx.App, ctx.UserID) {
+		return ctx.Send("Команда доступна только администраторам.")
+	}
+
+	correct, total, err := ctx.App.Store.GlobalStats()
+	if err != nil {
+		return fmt.Errorf("ошибка чтения глобальной статистики: %w", err)
+	}
+	if total == 0 {
+		return ctx.Send("Пока нет ни одного сохранённого ответа.")
+	}
+
+	accuracy := float64(correct) / float64(total) * 100
+	return ctx.Send(fmt.Sprintf("Всего ответов: %d\nПравильных: %d (%.1f%%)", total, correct, accuracy))
+}
+
+// watchQuizzesDir отслеживает директорию с темами через fsnotify и
+// автоматически перезагружает QuestionManager при изменении .json-файлов.
+// Включается необязательной переменной окружения QUIZZER_AUTO_RELOAD.
+func (app *App) watchQuizzesDir(dirPath string) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("Ошибка запуска наблюдателя за директорией тем: %v", err)
+		return
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(dirPath); err != nil {
+		log.Printf("Ошибка подписки на директорию тем %s: %v", dirPath, err)
+		return
+	}
+
+	log.Printf("Автоматическая перезагрузка тем включена для директории %s", dirPath)
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if strings.ToLower(filepath.Ext(event.Name)) != ".json" {
+				continue
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+				continue
+			}
+
+			if err := app.QuestionMgr.Reload(dirPath); err != nil {
+				log.Printf("Ошибка автоматической перезагрузки тем: %v", err)
+				continue
+			}
+			log.Printf("Темы автоматически перезагружены после изменения %s", event.Name)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Ошибка наблюдателя за директорией тем: %v", err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestSanitizeUploadFilename(t *testing.T) {
+	cases := []struct {
+		name     string
+		input    string
+		wantName string
+		wantOK   bool
+	}{
+		{"plain file", "quiz.json", "quiz.json", true},
+		{"directory traversal", "../../evil.json", "evil.json", true},
+		{"absolute path", "/etc/quiz.json", "quiz.json", true},
+		{"wrong extension", "quiz.txt", "", false},
+		{"no extension", "quiz", "", false},
+		{"empty name", "", "", false},
+		{"just dots", "..", "", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := sanitizeUploadFilename(tc.input)
+			if ok != tc.wantOK {
+				t.Fatalf("sanitizeUploadFilename(%q) ok = %v, want %v", tc.input, ok, tc.wantOK)
+			}
+			if ok && got != tc.wantName {
+				t.Errorf("sanitizeUploadFilename(%q) = %q, want %q", tc.input, got, tc.wantName)
+			}
+		})
+	}
+}
+
+func TestParseAdminIDs(t *testing.T) {
+	admins := parseAdminIDs("123, 456,,abc,789")
+
+	for _, id := range []int64{123, 456, 789} {
+		if !admins[id] {
+			t.Errorf("parseAdminIDs() missing expected admin id %d", id)
+		}
+	}
+	if len(admins) != 3 {
+		t.Errorf("len(admins) = %d, want 3 (invalid/blank entries should be skipped)", len(admins))
+	}
+}
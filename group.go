@@ -0,0 +1,460 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"math/rand"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// groupLobbyDuration — время набора игроков после /play перед первым вопросом.
+const groupLobbyDuration = 30 * time.Second
+
+// scoreCorrect — очки за правильный ответ в групповой викторине.
+const scoreCorrect = 2
+
+// Режимы начисления очков в групповой викторине.
+const (
+	scoringFirstCorrect = "first_correct"
+	scoringAllAnswered  = "all_answered"
+)
+
+// PlayerScore — очки одного участника групповой викторины.
+type PlayerScore struct {
+	UserID   int64
+	Username string
+	Score    int
+}
+
+// GameSession — одна групповая викторина в конкретном чате: от набора игроков
+// в лобби до финального табло. В отличие от UserState, session живёт только в
+// памяти — групповая игра не переживает перезапуск бота.
+type GameSession struct {
+	ChatID      int64
+	Theme       string
+	ScoringMode string
+	Questions   []Question
+
+	QuestionIndex int
+	Players       map[int64]*PlayerScore
+	Answered      map[int64]bool
+	State         string // "lobby", "question", "finished"
+
+	LeaderboardMessageID int
+	// QuestionMessageID — id сообщения с текущим вопросом, чтобы убрать с него
+	// клавиатуру, как только игра переходит к следующему вопросу.
+	QuestionMessageID int
+
+	mu sync.Mutex
+}
+
+// GameManager хранит активные групповые викторины, не более одной на чат.
+type GameManager struct {
+	mu       sync.Mutex
+	sessions map[int64]*GameSession
+}
+
+// NewGameManager создаёт пустой менеджер групповых викторин.
+func NewGameManager() *GameManager {
+	return &GameManager{sessions: make(map[int64]*GameSession)}
+}
+
+// Get возвращает активную сессию чата, если она есть.
+func (gm *GameManager) Get(chatID int64) (*GameSession, bool) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	s, ok := gm.sessions[chatID]
+	return s, ok
+}
+
+// Start создаёт новую сессию для чата в состоянии лобби, если в нём ещё нет
+// активной игры.
+func (gm *GameManager) Start(chatID int64, theme, scoringMode string) (*GameSession, error) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+
+	if _, exists := gm.sessions[chatID]; exists {
+		return nil, fmt.Errorf("в этом чате уже идёт групповая викторина")
+	}
+
+	session := &GameSession{
+		ChatID:      chatID,
+		Theme:       theme,
+		ScoringMode: scoringMode,
+		Players:     make(map[int64]*PlayerScore),
+		Answered:    make(map[int64]bool),
+		State:       "lobby",
+	}
+	gm.sessions[chatID] = session
+	return session, nil
+}
+
+// Remove удаляет сессию чата (по завершении игры либо при отмене лобби).
+func (gm *GameManager) Remove(chatID int64) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	delete(gm.sessions, chatID)
+}
+
+// handleGroupPlay обрабатывает команду /play <тема> [all]: набирает лобби
+// групповой игры и запускает таймер до первого вопроса. Необязательный
+// аргумент "all" включает режим начисления очков "все ответили" вместо
+// "первый верный ответ".
+func handleGroupPlay(ctx *Context) error {
+	args := strings.Fields(ctx.Update.Message.CommandArguments())
+	if len(args) == 0 {
+		return ctx.Send("Укажите тему: /play <тема> [all]")
+	}
+
+	scoringMode := scoringFirstCorrect
+	if args[len(args)-1] == "all" {
+		scoringMode = scoringAllAnswered
+		args = args[:len(args)-1]
+	}
+
+	theme := strings.Join(args, " ")
+	if _, themeExists := ctx.App.QuestionMgr.Theme(theme); !themeExists {
+		return ctx.Send(fmt.Sprintf("Тема %q не найдена. Посмотреть список тем можно через /start.", theme))
+	}
+
+	if _, err := ctx.App.Games.Start(ctx.ChatID, theme, scoringMode); err != nil {
+		return ctx.Send(err.Error())
+	}
+
+	chatID := ctx.ChatID
+	time.AfterFunc(groupLobbyDuration, func() {
+		ctx.App.beginGroupGame(chatID)
+	})
+
+	return ctx.Send(fmt.Sprintf(
+		"Групповая викторина по теме %q начнётся через %s. Присоединяйтесь командой /join!",
+		theme, groupLobbyDuration,
+	))
+}
+
+// handleGroupJoin обрабатывает команду /join: добавляет пользователя в лобби
+// текущей групповой игры чата.
+func handleGroupJoin(ctx *Context) error {
+	session, ok := ctx.App.Games.Get(ctx.ChatID)
+	if !ok {
+		return ctx.Send("В этом чате сейчас нет групповой викторины. Начните её командой /play <тема>.")
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if session.State != "lobby" {
+		return ctx.Send("Викторина уже началась — присоединиться можно только во время набора игроков.")
+	}
+
+	if _, already := session.Players[ctx.UserID]; !already {
+		session.Players[ctx.UserID] = &PlayerScore{UserID: ctx.UserID, Username: playerName(ctx.Update.Message.From)}
+	}
+
+	return ctx.Send(fmt.Sprintf("%s присоединился(ась) к игре! Игроков в лобби: %d", playerName(ctx.Update.Message.From), len(session.Players)))
+}
+
+// handleGroupLeave обрабатывает команду /leave: убирает пользователя из
+// лобби текущей групповой игры чата. Как и /join, доступна только до начала
+// игры — выход во время "question"/"finished" не поддерживается, чтобы
+// уменьшение Players на лету не ломало порог подсчёта ответов в режиме
+// "all_answered" и не оставляло сессию без единого живого игрока, способного
+// довести её до конца.
+func handleGroupLeave(ctx *Context) error {
+	session, ok := ctx.App.Games.Get(ctx.ChatID)
+	if !ok {
+		return ctx.Send("В этом чате сейчас нет групповой викторины.")
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if session.State != "lobby" {
+		return ctx.Send("Игра уже началась — покинуть её можно только во время набора игроков.")
+	}
+
+	if _, wasPlaying := session.Players[ctx.UserID]; !wasPlaying {
+		return ctx.Send("Вы и не участвовали в текущей игре.")
+	}
+	delete(session.Players, ctx.UserID)
+
+	return ctx.Send("Вы покинули игру.")
+}
+
+// playerName возвращает отображаемое имя игрока для таблицы лидеров.
+func playerName(user *tgbotapi.User) string {
+	if user == nil {
+		return "Игрок"
+	}
+	if user.UserName != "" {
+		return "@" + user.UserName
+	}
+	return strings.TrimSpace(user.FirstName + " " + user.LastName)
+}
+
+// beginGroupGame запускается по истечении таймера лобби: отменяет игру, если
+// никто не присоединился, иначе строит порядок вопросов и отправляет первый.
+func (app *App) beginGroupGame(chatID int64) {
+	session, ok := app.Games.Get(chatID)
+	if !ok {
+		return
+	}
+
+	session.mu.Lock()
+	if len(session.Players) == 0 {
+		session.mu.Unlock()
+		app.Games.Remove(chatID)
+		if _, err := app.Bot.Send(tgbotapi.NewMessage(chatID, "Никто не присоединился — групповая викторина отменена.")); err != nil {
+			log.Printf("Ошибка отправки отмены игры: %v", err)
+		}
+		return
+	}
+
+	themeQuestions, _ := app.QuestionMgr.Theme(session.Theme)
+	var singleChoice []Question
+	for _, q := range themeQuestions {
+		if q.Type == TypeSingle {
+			singleChoice = append(singleChoice, q)
+		}
+	}
+	if len(singleChoice) == 0 {
+		session.mu.Unlock()
+		app.Games.Remove(chatID)
+		if _, err := app.Bot.Send(tgbotapi.NewMessage(chatID, "В этой теме нет вопросов с одним правильным ответом — групповая игра невозможна.")); err != nil {
+			log.Printf("Ошибка отправки отмены игры: %v", err)
+		}
+		return
+	}
+
+	order := make([]int, len(singleChoice))
+	for i := range order {
+		order[i] = i
+	}
+	rand.Shuffle(len(order), func(i, j int) {
+		order[i], order[j] = order[j], order[i]
+	})
+
+	questions := make([]Question, len(order))
+	for i, idx := range order {
+		questions[i] = singleChoice[idx]
+	}
+
+	session.Questions = questions
+	session.QuestionIndex = 0
+	session.State = "question"
+	session.mu.Unlock()
+
+	app.postGameQuestion(session)
+}
+
+// postGameQuestion отправляет очередной вопрос сессии либо, если вопросы
+// закончились, завершает игру.
+func (app *App) postGameQuestion(session *GameSession) {
+	session.mu.Lock()
+	if session.QuestionIndex >= len(session.Questions) {
+		session.mu.Unlock()
+		app.finishGame(session)
+		return
+	}
+
+	q := session.Questions[session.QuestionIndex]
+	index, total := session.QuestionIndex, len(session.Questions)
+	previousMessageID := session.QuestionMessageID
+	session.Answered = make(map[int64]bool)
+	session.mu.Unlock()
+
+	if previousMessageID != 0 {
+		app.clearQuestionKeyboard(session.ChatID, previousMessageID)
+	}
+
+	keys := optionKeys(q)
+
+	text := fmt.Sprintf("*Вопрос %d/%d*\n\n%s\n\n", index+1, total, q.Question.Get(defaultLanguage))
+	var buttons []tgbotapi.InlineKeyboardButton
+	for _, key := range keys {
+		text += fmt.Sprintf("%s. %s\n", key, q.Options[key].Text.Get(defaultLanguage))
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(key, fmt.Sprintf("game_%d_%s", index, key)))
+	}
+
+	msg := tgbotapi.NewMessage(session.ChatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons)
+	sent, err := app.Bot.Send(msg)
+	if err != nil {
+		log.Printf("Ошибка отправки группового вопроса: %v", err)
+	} else {
+		session.mu.Lock()
+		session.QuestionMessageID = sent.MessageID
+		session.mu.Unlock()
+	}
+
+	app.postLeaderboard(session)
+}
+
+// clearQuestionKeyboard убирает клавиатуру с сообщения предыдущего вопроса,
+// чтобы игроки не могли ответить на уже закрытый вопрос.
+func (app *App) clearQuestionKeyboard(chatID int64, messageID int) {
+	empty := tgbotapi.NewInlineKeyboardMarkup()
+	edit := tgbotapi.NewEditMessageReplyMarkup(chatID, messageID, empty)
+	if _, err := app.Bot.Send(edit); err != nil {
+		log.Printf("Ошибка снятия клавиатуры с предыдущего вопроса: %v", err)
+	}
+}
+
+// handleGameAnswer обрабатывает нажатие на кнопку с ответом в групповой
+// викторине: засчитывает не более одного ответа на игрока за вопрос и
+// переходит к следующему вопросу по первому верному ответу (режим
+// "first_correct") либо, в любом режиме, когда ответили все участники лобби
+// (в режиме "all_answered" — только так).
+// Callback-данные несут индекс вопроса, на который была нажата кнопка
+// ("game_<index>_<letter>") — это позволяет отличить опоздавший ответ на уже
+// закрытый вопрос от ответа на текущий, даже если оба используют одну и ту же
+// букву варианта.
+func handleGameAnswer(ctx *Context, data string) error {
+	questionIndex, key, ok := parseGameAnswerData(data)
+	if !ok {
+		return nil
+	}
+
+	session, ok := ctx.App.Games.Get(ctx.ChatID)
+	if !ok {
+		return nil
+	}
+
+	session.mu.Lock()
+	if session.State != "question" || questionIndex != session.QuestionIndex {
+		session.mu.Unlock()
+		return nil
+	}
+	if _, isPlayer := session.Players[ctx.UserID]; !isPlayer {
+		session.mu.Unlock()
+		return nil
+	}
+	if session.Answered[ctx.UserID] {
+		session.mu.Unlock()
+		return nil
+	}
+
+	q := session.Questions[session.QuestionIndex]
+	correct := contains(q.CorrectAnswer, key)
+	session.Answered[ctx.UserID] = true
+	if correct {
+		session.Players[ctx.UserID].Score += scoreCorrect
+	}
+
+	advance := (correct && session.ScoringMode == scoringFirstCorrect) || len(session.Answered) >= len(session.Players)
+	if advance {
+		session.QuestionIndex++
+	}
+	theme := session.Theme
+	session.mu.Unlock()
+
+	if err := ctx.App.Store.RecordReview(ctx.UserID, theme, q.Id, reviewQuality(correct)); err != nil {
+		log.Printf("Ошибка обновления расписания повторения: %v", err)
+	}
+
+	if advance {
+		ctx.App.postGameQuestion(session)
+	}
+
+	return nil
+}
+
+// parseGameAnswerData разбирает callback-данные кнопки ответа вида
+// "game_<questionIndex>_<letter>".
+func parseGameAnswerData(data string) (questionIndex int, key string, ok bool) {
+	rest := strings.TrimPrefix(data, "game_")
+	if rest == data {
+		return 0, "", false
+	}
+
+	parts := strings.SplitN(rest, "_", 2)
+	if len(parts) != 2 {
+		return 0, "", false
+	}
+
+	index, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", false
+	}
+
+	return index, strings.ToUpper(parts[1]), true
+}
+
+// postLeaderboard отправляет таблицу лидеров при первом вопросе и затем
+// редактирует то же сообщение после каждого следующего.
+func (app *App) postLeaderboard(session *GameSession) {
+	session.mu.Lock()
+	text := leaderboardText(session, false)
+	messageID := session.LeaderboardMessageID
+	session.mu.Unlock()
+
+	if messageID == 0 {
+		msg := tgbotapi.NewMessage(session.ChatID, text)
+		msg.ParseMode = "Markdown"
+		sent, err := app.Bot.Send(msg)
+		if err != nil {
+			log.Printf("Ошибка отправки таблицы лидеров: %v", err)
+			return
+		}
+
+		session.mu.Lock()
+		session.LeaderboardMessageID = sent.MessageID
+		session.mu.Unlock()
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageText(session.ChatID, messageID, text)
+	edit.ParseMode = "Markdown"
+	if _, err := app.Bot.Send(edit); err != nil {
+		log.Printf("Ошибка обновления таблицы лидеров: %v", err)
+	}
+}
+
+// finishGame объявляет финальную таблицу лидеров и удаляет сессию чата.
+func (app *App) finishGame(session *GameSession) {
+	session.mu.Lock()
+	session.State = "finished"
+	text := leaderboardText(session, true)
+	session.mu.Unlock()
+
+	msg := tgbotapi.NewMessage(session.ChatID, text)
+	msg.ParseMode = "Markdown"
+	if _, err := app.Bot.Send(msg); err != nil {
+		log.Printf("Ошибка отправки финальной таблицы лидеров: %v", err)
+	}
+
+	app.Games.Remove(session.ChatID)
+}
+
+// leaderboardText строит отранжированную по очкам таблицу лидеров. Вызывающий
+// обязан удерживать session.mu.
+func leaderboardText(session *GameSession, final bool) string {
+	players := make([]*PlayerScore, 0, len(session.Players))
+	for _, p := range session.Players {
+		players = append(players, p)
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i].Score > players[j].Score })
+
+	header := "*Таблица лидеров:*\n"
+	if final {
+		header = "*Игра окончена! Итоговая таблица лидеров:*\n"
+	}
+
+	text := header
+	for i, p := range players {
+		text += fmt.Sprintf("%d. %s — %d\n", i+1, p.Username, p.Score)
+	}
+	if len(players) == 0 {
+		text += "пока никто не набрал очков\n"
+	}
+
+	return text
+}
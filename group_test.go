@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestParseGameAnswerData(t *testing.T) {
+	cases := []struct {
+		name      string
+		data      string
+		wantIndex int
+		wantKey   string
+		wantOK    bool
+	}{
+		{"valid", "game_2_A", 2, "A", true},
+		{"lowercase key", "game_0_b", 0, "B", true},
+		{"not a game callback", "toggle_A", 0, "", false},
+		{"missing key", "game_2", 0, "", false},
+		{"non-numeric index", "game_x_A", 0, "", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			index, key, ok := parseGameAnswerData(tc.data)
+			if ok != tc.wantOK {
+				t.Fatalf("parseGameAnswerData(%q) ok = %v, want %v", tc.data, ok, tc.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if index != tc.wantIndex || key != tc.wantKey {
+				t.Errorf("parseGameAnswerData(%q) = (%d, %q), want (%d, %q)", tc.data, index, key, tc.wantIndex, tc.wantKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,859 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"math/rand"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/issa0sg/quizzer/storage"
+)
+
+// registerRoutes регистрирует все команды и конечные точки бота на маршрутизаторе.
+func registerRoutes(r *Router) {
+	r.Handle("start", handleStart)
+	r.Handle("help", handleHelp)
+	r.Handle("restart", handleRestart)
+	r.Handle("stats", handleStats)
+	r.Handle("stats_difficulty", handleStatsDifficulty)
+	r.Handle("history", handleHistory)
+	r.Handle("subscribe", handleSubscribe)
+	r.Handle("unsubscribe", handleUnsubscribe)
+	r.Handle(OnCallback, handleCallback)
+	r.Handle(OnText, handleFreeTextAnswer)
+	r.Handle(OnPollAnswer, handlePollAnswer)
+	r.Handle("play", handleGroupPlay)
+	r.Handle("join", handleGroupJoin)
+	r.Handle("leave", handleGroupLeave)
+	r.Handle("reload", handleReload)
+	r.Handle("upload", handleUpload)
+	r.Handle("themes", handleThemes)
+	r.Handle("broadcast", handleBroadcast)
+	r.Handle("stats_global", handleStatsGlobal)
+	r.Handle("review", handleReviewStart)
+	r.Handle("due", handleDue)
+}
+
+// Обработка команды /start
+func handleStart(ctx *Context) error {
+	// Создание нового состояния пользователя; WithUserStateMiddleware сохранит его
+	// после возврата обработчика.
+	ctx.State = &storage.UserState{UserID: ctx.UserID, SetupStep: "select_theme"}
+
+	themes := ctx.App.QuestionMgr.ThemeNames()
+
+	if len(themes) == 0 {
+		return ctx.Send("Темы не найдены. Пожалуйста, попробуйте позже.")
+	}
+
+	var buttons [][]tgbotapi.InlineKeyboardButton
+	for _, theme := range themes {
+		button := tgbotapi.NewInlineKeyboardButtonData(theme, fmt.Sprintf("theme_%s", theme))
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(button))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons...)
+
+	msg := tgbotapi.NewMessage(ctx.ChatID, "Выберите тему для викторины:")
+	msg.ReplyMarkup = keyboard
+	_, err := ctx.App.Bot.Send(msg)
+	return err
+}
+
+// Обработка команды /help
+func handleHelp(ctx *Context) error {
+	helpText := "Доступные команды:\n" +
+		"/start - Начать викторину в стандартном порядке\n" +
+		"/random - Начать викторину в случайном порядке\n" +
+		"/restart - Перезапустить викторину\n" +
+		"/stats - Показать статистику ответов по темам\n" +
+		"/stats_difficulty - Показать статистику ответов по темам и сложности вопросов\n" +
+		"/history - Показать историю прохождений\n" +
+		"/subscribe - Подписаться на вопрос дня\n" +
+		"/unsubscribe - Отписаться от вопроса дня\n" +
+		"/play <тема> [all] - Начать групповую викторину в чате\n" +
+		"/join - Присоединиться к групповой викторине\n" +
+		"/leave - Покинуть групповую викторину\n" +
+		"/review - Повторить вопросы, срок которых настал (SM-2)\n" +
+		"/due - Показать число вопросов к повторению по темам\n" +
+		"/help - Показать список команд\n\n" +
+		"Команды для администраторов (см. TELEGRAM_ADMINS):\n" +
+		"/reload, /upload, /themes, /broadcast <текст>, /stats_global"
+	return ctx.Send(helpText)
+}
+
+// Обработка команды /restart
+func handleRestart(ctx *Context) error {
+	allQuestions := ctx.App.QuestionMgr.AllQuestions()
+
+	if len(allQuestions) == 0 {
+		return ctx.Send("Вопросы не найдены. Пожалуйста, попробуйте позже.")
+	}
+
+	order := make([]int, len(allQuestions))
+	for i := range order {
+		order[i] = i
+	}
+
+	selectedTheme := ""
+	if ctx.State != nil {
+		selectedTheme = ctx.State.SelectedTheme
+	}
+
+	attemptID, err := ctx.App.Store.StartAttempt(ctx.UserID, selectedTheme)
+	if err != nil {
+		return fmt.Errorf("ошибка создания попытки: %w", err)
+	}
+
+	ctx.State = &storage.UserState{
+		UserID:        ctx.UserID,
+		AttemptID:     attemptID,
+		QuestionOrder: order,
+		SelectedTheme: selectedTheme,
+	}
+
+	log.Printf("Пользователь %s перезапустил викторину", ctx.Update.Message.From.UserName)
+
+	if err := ctx.Send("Викторина перезапущена."); err != nil {
+		log.Printf("Ошибка при отправке сообщения: %v", err)
+	}
+
+	return ctx.sendQuestion()
+}
+
+// sendQuestion отправляет текущий вопрос пользователю либо, если викторина
+// завершена, итоговый счёт — после чего фиксирует попытку и сбрасывает состояние.
+func (ctx *Context) sendQuestion() error {
+	state := ctx.State
+	if state == nil {
+		return ctx.Send("Пожалуйста, начните викторину с помощью команды /start или /random.")
+	}
+
+	questions, themeExists := ctx.App.QuestionMgr.Theme(state.SelectedTheme)
+	if !themeExists || len(questions) == 0 {
+		return ctx.Send("Выбранная тема недоступна. Пожалуйста, выберите другую тему с помощью /start.")
+	}
+
+	if state.CurrentQuestion >= len(questions) {
+		return ctx.finishQuiz(questions)
+	}
+
+	currentIndex := state.QuestionOrder[state.CurrentQuestion]
+	if currentIndex >= len(questions) {
+		return ctx.Send("Ошибка: неправильный индекс вопроса.")
+	}
+
+	q := questions[currentIndex]
+	state.PendingAnswers = nil
+	if q.Type == TypeFreeText {
+		state.SetupStep = "awaiting_free_text"
+	} else {
+		state.SetupStep = ""
+	}
+
+	return ctx.renderQuestion(q)
+}
+
+// finishQuiz сообщает итоговый счёт, фиксирует попытку в хранилище и сбрасывает
+// состояние пользователя.
+func (ctx *Context) finishQuiz(questions []Question) error {
+	state := ctx.State
+
+	if err := ctx.Send(fmt.Sprintf("Викторина завершена! Ваш счёт: %d/%d", state.Score, len(questions))); err != nil {
+		log.Printf("Ошибка при отправке сообщения: %v", err)
+	}
+	if err := ctx.App.Store.FinishAttempt(state.AttemptID, state.Score, len(questions)); err != nil {
+		log.Printf("Ошибка завершения попытки: %v", err)
+	}
+	if err := ctx.App.Store.DeleteUserState(ctx.UserID); err != nil {
+		log.Printf("Ошибка удаления состояния пользователя: %v", err)
+	}
+	ctx.State = nil
+
+	return nil
+}
+
+// renderQuestion отправляет вложения вопроса (если есть) и сам вопрос: обычными
+// кнопками для одиночного выбора, кнопками-переключателями с рядом "Отправить
+// ответ" для множественного выбора и упорядочивания, либо ForceReply для
+// свободного ответа.
+func (ctx *Context) renderQuestion(q Question) error {
+	if err := ctx.sendQuestionMedia(q); err != nil {
+		log.Printf("Ошибка при отправке вложения вопроса: %v", err)
+	}
+
+	if q.Type == TypeSingle && ctx.State.RenderMode == "poll" {
+		return ctx.renderPollQuestion(q)
+	}
+
+	keys := optionKeys(q)
+
+	questionText := "*" + q.Question.Get(defaultLanguage) + "*\n\n"
+	for _, key := range keys {
+		questionText += fmt.Sprintf("%s. %s\n", key, q.Options[key].Text.Get(defaultLanguage))
+	}
+
+	msg := tgbotapi.NewMessage(ctx.ChatID, questionText)
+	msg.ParseMode = "Markdown"
+
+	switch q.Type {
+	case TypeFreeText:
+		msg.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true}
+
+	case TypeMulti, TypeOrdering:
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, key := range keys {
+			label := "☐ " + key
+			if contains(ctx.State.PendingAnswers, key) {
+				label = "☑ " + key
+			}
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(label, "toggle_"+key)))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("Отправить ответ", "submit_answer")))
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	default:
+		var buttons []tgbotapi.InlineKeyboardButton
+		for _, key := range keys {
+			buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(key, key))
+		}
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons)
+	}
+
+	_, err := ctx.App.Bot.Send(msg)
+	return err
+}
+
+// sendQuestionMedia отправляет прикреплённые к вопросу фото/аудио, если они
+// заданы, перед самим текстом вопроса.
+func (ctx *Context) sendQuestionMedia(q Question) error {
+	if q.Image != "" {
+		if _, err := ctx.App.Bot.Send(tgbotapi.NewPhoto(ctx.ChatID, tgbotapi.FilePath(q.Image))); err != nil {
+			return fmt.Errorf("ошибка отправки изображения: %w", err)
+		}
+	}
+	if q.Audio != "" {
+		if _, err := ctx.App.Bot.Send(tgbotapi.NewAudio(ctx.ChatID, tgbotapi.FilePath(q.Audio))); err != nil {
+			return fmt.Errorf("ошибка отправки аудио: %w", err)
+		}
+	}
+	return nil
+}
+
+// renderPollQuestion отправляет вопрос с одним правильным ответом в виде
+// нативного quiz-опроса Telegram вместо обычных кнопок. Ответ на него приходит
+// отдельным обновлением PollAnswer, не содержащим chat id, поэтому соответствие
+// опрос -> чат и порядок вариантов сохраняется в App.Polls до получения ответа.
+func (ctx *Context) renderPollQuestion(q Question) error {
+	keys := optionKeys(q)
+
+	options := make([]string, len(keys))
+	correctOptionID := -1
+	for i, key := range keys {
+		options[i] = q.Options[key].Text.Get(defaultLanguage)
+		if contains(q.CorrectAnswer, key) {
+			correctOptionID = i
+		}
+	}
+	if correctOptionID == -1 {
+		return fmt.Errorf("вопрос id=%d: правильный ответ не найден среди вариантов опроса", q.Id)
+	}
+
+	poll := tgbotapi.NewPoll(ctx.ChatID, q.Question.Get(defaultLanguage), options...)
+	poll.Type = "quiz"
+	poll.IsAnonymous = false
+	poll.CorrectOptionID = int64(correctOptionID)
+
+	sent, err := ctx.App.Bot.Send(poll)
+	if err != nil {
+		return fmt.Errorf("ошибка отправки опроса: %w", err)
+	}
+	if sent.Poll == nil {
+		return fmt.Errorf("телеграм не вернул данные опроса для вопроса id=%d", q.Id)
+	}
+
+	ctx.App.pollMu.Lock()
+	ctx.App.Polls[sent.Poll.ID] = pollAttribution{ChatID: ctx.ChatID, OptionKeys: keys}
+	ctx.App.pollMu.Unlock()
+
+	return nil
+}
+
+// optionKeys возвращает ключи вариантов ответа в порядке показа: случайном, если
+// задан ShuffleOptions, иначе отсортированном по алфавиту для стабильности.
+func optionKeys(q Question) []string {
+	keys := make([]string, 0, len(q.Options))
+	for key := range q.Options {
+		keys = append(keys, key)
+	}
+
+	if q.ShuffleOptions {
+		rand.Shuffle(len(keys), func(i, j int) {
+			keys[i], keys[j] = keys[j], keys[i]
+		})
+	} else {
+		sort.Strings(keys)
+	}
+
+	return keys
+}
+
+// explanationFor возвращает строку с пояснением к варианту key, если оно задано.
+func explanationFor(q Question, key string) string {
+	opt, ok := q.Options[key]
+	if !ok {
+		return ""
+	}
+	explanation := opt.Explanation.Get(defaultLanguage)
+	if explanation == "" {
+		return ""
+	}
+	return "Пояснение: " + explanation + "\n"
+}
+
+// handleCallback обрабатывает нажатия на инлайн-кнопки: выбор темы, выбор порядка
+// вопросов и сами ответы на вопросы викторины.
+func handleCallback(ctx *Context) error {
+	defer ctx.App.answerCallback(ctx.Update.CallbackQuery.ID)
+
+	// Ответы в групповой викторине разбираются отдельно от персональной
+	// настройки/ответов: они привязаны к сессии чата, а не к UserState.
+	if data := ctx.Data(); strings.HasPrefix(data, "game_") {
+		return handleGameAnswer(ctx, data)
+	}
+
+	// Ответы в сессии повторения (SM-2) тоже не связаны с UserState — сессия
+	// повторения ведётся отдельно от текущей викторины.
+	if data := ctx.Data(); strings.HasPrefix(data, "review_") {
+		return handleReviewAnswer(ctx, data)
+	}
+
+	if ctx.State == nil {
+		return ctx.Send("Пожалуйста, начните викторину с помощью команды /start.")
+	}
+
+	state := ctx.State
+	data := ctx.Data()
+
+	switch state.SetupStep {
+	case "select_theme":
+		theme, ok := extractCallbackTheme(data)
+		if !ok {
+			return nil
+		}
+		state.SelectedTheme = theme
+		state.SetupStep = "select_order"
+
+		buttons := [][]tgbotapi.InlineKeyboardButton{
+			{tgbotapi.NewInlineKeyboardButtonData("Упорядоченный", "order_ordered")},
+			{tgbotapi.NewInlineKeyboardButtonData("Случайный", "order_random")},
+		}
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons...)
+
+		msg := tgbotapi.NewMessage(ctx.ChatID, "Выберите порядок вопросов:")
+		msg.ReplyMarkup = keyboard
+		_, err := ctx.App.Bot.Send(msg)
+		return err
+
+	case "select_order":
+		if data != "order_ordered" && data != "order_random" {
+			return nil
+		}
+
+		questions, themeExists := ctx.App.QuestionMgr.Theme(state.SelectedTheme)
+		if !themeExists || len(questions) == 0 {
+			return ctx.Send("Выбранная тема недоступна. Пожалуйста, начните викторину снова с помощью /start.")
+		}
+
+		order := make([]int, len(questions))
+		for i := range order {
+			order[i] = i
+		}
+		if data == "order_random" {
+			rand.Shuffle(len(order), func(i, j int) {
+				order[i], order[j] = order[j], order[i]
+			})
+		}
+
+		state.QuestionOrder = order
+		state.SetupStep = "select_mode"
+
+		buttons := [][]tgbotapi.InlineKeyboardButton{
+			{tgbotapi.NewInlineKeyboardButtonData("Обычные кнопки", "mode_classic")},
+			{tgbotapi.NewInlineKeyboardButtonData("Опрос Telegram", "mode_poll")},
+		}
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons...)
+
+		msg := tgbotapi.NewMessage(ctx.ChatID, "Выберите способ показа вопросов:")
+		msg.ReplyMarkup = keyboard
+		_, err := ctx.App.Bot.Send(msg)
+		return err
+
+	case "select_mode":
+		if data != "mode_classic" && data != "mode_poll" {
+			return nil
+		}
+
+		if data == "mode_poll" {
+			state.RenderMode = "poll"
+		} else {
+			state.RenderMode = ""
+		}
+
+		attemptID, err := ctx.App.Store.StartAttempt(ctx.UserID, state.SelectedTheme)
+		if err != nil {
+			return fmt.Errorf("ошибка создания попытки: %w", err)
+		}
+
+		state.AttemptID = attemptID
+		state.CurrentQuestion = 0
+		state.Score = 0
+		state.SetupStep = ""
+
+		log.Printf("Пользователь %s начал викторину по теме: %s, режим показа: %s",
+			ctx.Update.CallbackQuery.From.UserName, state.SelectedTheme, data)
+
+		return ctx.sendQuestion()
+
+	default:
+		return handleAnswer(ctx, data)
+	}
+}
+
+// handleAnswer определяет тип текущего вопроса и передаёт управление
+// соответствующему обработчику ответа.
+func handleAnswer(ctx *Context, data string) error {
+	state := ctx.State
+
+	questions, themeExists := ctx.App.QuestionMgr.Theme(state.SelectedTheme)
+	if !themeExists || len(questions) == 0 {
+		return ctx.Send("Выбранная тема недоступна. Пожалуйста, выберите другую тему с помощью /start.")
+	}
+	if state.CurrentQuestion >= len(questions) {
+		return ctx.Send("Викторина уже завершена. Начните заново с помощью /start или /random.")
+	}
+
+	q := questions[state.QuestionOrder[state.CurrentQuestion]]
+
+	switch q.Type {
+	case TypeMulti, TypeOrdering:
+		return handleToggleAnswer(ctx, q, questions, data)
+	default:
+		return handleSingleAnswer(ctx, q, questions, data)
+	}
+}
+
+// handleSingleAnswer обрабатывает вопросы с одним правильным вариантом: ответ
+// засчитывается сразу по нажатию кнопки.
+func handleSingleAnswer(ctx *Context, q Question, questions []Question, data string) error {
+	state := ctx.State
+	selectedLetter := strings.ToUpper(strings.TrimSpace(data))
+
+	var response string
+	isCorrect := false
+	if selectedLetter == "" {
+		response = "Некорректный выбор. Пожалуйста, используйте предоставленные кнопки."
+	} else if contains(q.CorrectAnswer, selectedLetter) {
+		state.Score++
+		isCorrect = true
+		response = "Правильно! 👍\n"
+	} else {
+		response = "Неправильно. ❌\n"
+		correctOption := q.CorrectAnswer[0] // Предполагаем, что только один правильный ответ
+		response += fmt.Sprintf("Правильный ответ: %s: %s\n", correctOption, q.Options[correctOption].Text.Get(defaultLanguage))
+	}
+	if selectedLetter != "" {
+		response += explanationFor(q, selectedLetter)
+	}
+	response += "Ваш текущий счёт: " + strconv.Itoa(state.Score) + "/" + strconv.Itoa(len(questions))
+
+	var recorded []string
+	if selectedLetter != "" {
+		recorded = []string{selectedLetter}
+	}
+
+	return ctx.finishAnswer(q, questions, recorded, isCorrect, response)
+}
+
+// handleToggleAnswer обрабатывает вопросы с множественным выбором и
+// упорядочиванием: нажатия на кнопки копят выбор в PendingAnswers, а отдельная
+// кнопка "Отправить ответ" засчитывает его.
+func handleToggleAnswer(ctx *Context, q Question, questions []Question, data string) error {
+	state := ctx.State
+
+	if data == "submit_answer" {
+		selected := state.PendingAnswers
+		state.PendingAnswers = nil
+
+		var isCorrect bool
+		if q.Type == TypeOrdering {
+			isCorrect = equalSequence(selected, q.CorrectAnswer)
+		} else {
+			isCorrect = equalSet(selected, q.CorrectAnswer)
+		}
+
+		var response string
+		switch {
+		case len(selected) == 0:
+			response = "Вы не выбрали ни одного варианта.\n"
+		case isCorrect:
+			state.Score++
+			response = "Правильно! 👍\n"
+		default:
+			response = "Неправильно. ❌\n"
+			response += fmt.Sprintf("Правильный ответ: %s\n", strings.Join(q.CorrectAnswer, ", "))
+		}
+		for _, key := range selected {
+			response += explanationFor(q, key)
+		}
+		response += "Ваш текущий счёт: " + strconv.Itoa(state.Score) + "/" + strconv.Itoa(len(questions))
+
+		return ctx.finishAnswer(q, questions, selected, isCorrect, response)
+	}
+
+	key, ok := extractToggleKey(data)
+	if !ok {
+		return nil
+	}
+	if _, known := q.Options[key]; !known {
+		return nil
+	}
+
+	if q.Type == TypeOrdering {
+		if !contains(state.PendingAnswers, key) {
+			state.PendingAnswers = append(state.PendingAnswers, key)
+		}
+	} else {
+		state.PendingAnswers = toggleKey(state.PendingAnswers, key)
+	}
+
+	return ctx.renderQuestion(q)
+}
+
+// handleFreeTextAnswer обрабатывает обычные текстовые сообщения, когда
+// пользователь ожидает вопрос со свободным ответом.
+func handleFreeTextAnswer(ctx *Context) error {
+	state := ctx.State
+	if state == nil || state.SetupStep != "awaiting_free_text" {
+		return nil
+	}
+
+	questions, themeExists := ctx.App.QuestionMgr.Theme(state.SelectedTheme)
+	if !themeExists || len(questions) == 0 || state.CurrentQuestion >= len(questions) {
+		return nil
+	}
+
+	q := questions[state.QuestionOrder[state.CurrentQuestion]]
+	answer := strings.TrimSpace(ctx.Text())
+
+	isCorrect := false
+	for _, accepted := range q.CorrectAnswer {
+		if strings.EqualFold(strings.TrimSpace(accepted), answer) {
+			isCorrect = true
+			break
+		}
+	}
+
+	var response string
+	if isCorrect {
+		state.Score++
+		response = "Правильно! 👍\n"
+	} else {
+		response = "Неправильно. ❌\n"
+		response += fmt.Sprintf("Правильный ответ: %s\n", strings.Join(q.CorrectAnswer, ", "))
+	}
+	response += "Ваш текущий счёт: " + strconv.Itoa(state.Score) + "/" + strconv.Itoa(len(questions))
+
+	var recorded []string
+	if answer != "" {
+		recorded = []string{answer}
+	}
+
+	return ctx.finishAnswer(q, questions, recorded, isCorrect, response)
+}
+
+// handlePollAnswer обрабатывает ответ на нативный quiz-опрос: сопоставляет
+// PollAnswer.PollID с чатом и порядком вариантов через App.Polls и засчитывает
+// выбранный вариант так же, как и обычный ответ на вопрос с одним правильным
+// ответом.
+func handlePollAnswer(ctx *Context) error {
+	pa := ctx.PollAnswer()
+	if pa == nil {
+		return nil
+	}
+
+	ctx.App.pollMu.Lock()
+	attribution, ok := ctx.App.Polls[pa.PollID]
+	if ok {
+		delete(ctx.App.Polls, pa.PollID)
+	}
+	ctx.App.pollMu.Unlock()
+
+	if !ok || len(pa.OptionIDs) == 0 {
+		// Неизвестный опрос либо пользователь отозвал свой ответ — отзыв
+		// ответа в quiz-опросах Telegram не поддерживается.
+		return nil
+	}
+	ctx.ChatID = attribution.ChatID
+
+	state := ctx.State
+	if state == nil {
+		return nil
+	}
+
+	questions, themeExists := ctx.App.QuestionMgr.Theme(state.SelectedTheme)
+	if !themeExists || len(questions) == 0 || state.CurrentQuestion >= len(questions) {
+		return nil
+	}
+
+	optionIndex := pa.OptionIDs[0]
+	if optionIndex < 0 || optionIndex >= len(attribution.OptionKeys) {
+		return nil
+	}
+
+	q := questions[state.QuestionOrder[state.CurrentQuestion]]
+	return handleSingleAnswer(ctx, q, questions, attribution.OptionKeys[optionIndex])
+}
+
+// finishAnswer сохраняет ответ, отправляет сообщение с результатом и переходит к
+// следующему вопросу либо завершает викторину.
+func (ctx *Context) finishAnswer(q Question, questions []Question, selected []string, isCorrect bool, response string) error {
+	state := ctx.State
+	state.CurrentQuestion++
+
+	if len(selected) > 0 {
+		if err := ctx.App.Store.RecordAnswer(state.AttemptID, ctx.UserID, state.SelectedTheme, q.Id, strings.Join(selected, ","), isCorrect); err != nil {
+			log.Printf("Ошибка сохранения ответа: %v", err)
+		}
+	}
+
+	if q.Type == TypeSingle {
+		if err := ctx.App.Store.RecordReview(ctx.UserID, state.SelectedTheme, q.Id, reviewQuality(isCorrect)); err != nil {
+			log.Printf("Ошибка обновления расписания повторения: %v", err)
+		}
+	}
+
+	if _, err := ctx.App.Bot.Send(tgbotapi.NewMessage(ctx.ChatID, response)); err != nil {
+		log.Printf("Ошибка при отправке результата: %v", err)
+	}
+
+	if state.CurrentQuestion < len(questions) {
+		return ctx.sendQuestion()
+	}
+
+	finalMsg := tgbotapi.NewMessage(ctx.ChatID, fmt.Sprintf("Поздравляем! Вы завершили викторину.\nВаш итоговый счёт: %d/%d", state.Score, len(questions)))
+	if _, err := ctx.App.Bot.Send(finalMsg); err != nil {
+		log.Printf("Ошибка при отправке итогового сообщения: %v", err)
+	}
+
+	if err := ctx.App.Store.FinishAttempt(state.AttemptID, state.Score, len(questions)); err != nil {
+		log.Printf("Ошибка завершения попытки: %v", err)
+	}
+	if err := ctx.App.Store.DeleteUserState(ctx.UserID); err != nil {
+		log.Printf("Ошибка удаления состояния пользователя: %v", err)
+	}
+	ctx.State = nil
+
+	return nil
+}
+
+// extractToggleKey извлекает ключ варианта из callback-данных вида "toggle_A".
+func extractToggleKey(data string) (string, bool) {
+	if !strings.HasPrefix(data, "toggle_") {
+		return "", false
+	}
+	return strings.TrimPrefix(data, "toggle_"), true
+}
+
+// toggleKey добавляет key в keys, если его там нет, либо убирает, если он уже есть.
+func toggleKey(keys []string, key string) []string {
+	for i, k := range keys {
+		if k == key {
+			return append(keys[:i], keys[i+1:]...)
+		}
+	}
+	return append(keys, key)
+}
+
+// equalSet сравнивает два набора ключей без учёта порядка и регистра.
+func equalSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]bool, len(a))
+	for _, v := range a {
+		set[strings.ToUpper(v)] = true
+	}
+	for _, v := range b {
+		if !set[strings.ToUpper(v)] {
+			return false
+		}
+	}
+	return true
+}
+
+// equalSequence сравнивает два списка ключей поэлементно, с учётом порядка.
+func equalSequence(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(slice []string, item string) bool {
+	for _, s := range slice {
+		if strings.EqualFold(s, item) {
+			return true
+		}
+	}
+	return false
+}
+
+func (app *App) answerCallback(callbackID string) {
+	answer := tgbotapi.NewCallback(callbackID, "")
+	if _, err := app.Bot.Request(answer); err != nil {
+		log.Printf("Ошибка при ответе на CallbackQuery: %v", err)
+	}
+}
+
+// Обработка команды /stats
+func handleStats(ctx *Context) error {
+	stats, err := ctx.App.Store.ThemeStats(ctx.UserID)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения статистики: %w", err)
+	}
+
+	if len(stats) == 0 {
+		return ctx.Send("Пока нет статистики. Пройдите викторину с помощью /start.")
+	}
+
+	text := "Ваша статистика по темам:\n"
+	for _, st := range stats {
+		total := st.Correct + st.Incorrect
+		text += fmt.Sprintf("%s: %d/%d верно\n", st.Theme, st.Correct, total)
+	}
+
+	return ctx.Send(text)
+}
+
+// diffStat — агрегированные верные/неверные ответы для одной пары
+// (тема, сложность) в /stats_difficulty.
+type diffStat struct {
+	Correct   int
+	Incorrect int
+}
+
+// Обработка команды /stats_difficulty — статистика ответов пользователя по
+// темам с разбивкой по сложности вопроса (Question.Difficulty). Сложность не
+// хранится в answers, поэтому берётся из текущего QuestionManager по
+// (тема, question_id); вопросы, удалённые из тем после ответа, попадают в
+// категорию "неизвестно".
+func handleStatsDifficulty(ctx *Context) error {
+	stats, err := ctx.App.Store.QuestionStats(ctx.UserID)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения статистики по сложности: %w", err)
+	}
+
+	if len(stats) == 0 {
+		return ctx.Send("Пока нет статистики. Пройдите викторину с помощью /start.")
+	}
+
+	byTheme := make(map[string]map[string]*diffStat)
+	for _, st := range stats {
+		difficulty := "неизвестно"
+		if q, ok := ctx.App.QuestionMgr.QuestionByID(st.Theme, st.QuestionID); ok {
+			if q.Difficulty != "" {
+				difficulty = q.Difficulty
+			} else {
+				difficulty = "не указана"
+			}
+		}
+
+		if byTheme[st.Theme] == nil {
+			byTheme[st.Theme] = make(map[string]*diffStat)
+		}
+		d := byTheme[st.Theme][difficulty]
+		if d == nil {
+			d = &diffStat{}
+			byTheme[st.Theme][difficulty] = d
+		}
+		d.Correct += st.Correct
+		d.Incorrect += st.Incorrect
+	}
+
+	themes := make([]string, 0, len(byTheme))
+	for theme := range byTheme {
+		themes = append(themes, theme)
+	}
+	sort.Strings(themes)
+
+	text := "Ваша статистика по темам и сложности:\n"
+	for _, theme := range themes {
+		text += theme + ":\n"
+
+		difficulties := make([]string, 0, len(byTheme[theme]))
+		for difficulty := range byTheme[theme] {
+			difficulties = append(difficulties, difficulty)
+		}
+		sort.Strings(difficulties)
+
+		for _, difficulty := range difficulties {
+			d := byTheme[theme][difficulty]
+			text += fmt.Sprintf("  %s: %d/%d верно\n", difficulty, d.Correct, d.Correct+d.Incorrect)
+		}
+	}
+
+	return ctx.Send(text)
+}
+
+// Обработка команды /history
+func handleHistory(ctx *Context) error {
+	const historyLimit = 10
+
+	attempts, err := ctx.App.Store.History(ctx.UserID, historyLimit)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения истории: %w", err)
+	}
+
+	if len(attempts) == 0 {
+		return ctx.Send("История прохождений пуста.")
+	}
+
+	text := "Последние прохождения:\n"
+	for _, a := range attempts {
+		text += fmt.Sprintf("%s — %d/%d (%s)\n", a.Theme, a.Score, a.Total, a.FinishedAt.Time.Format("02.01.2006 15:04"))
+	}
+
+	return ctx.Send(text)
+}
+
+// Обработка команды /subscribe
+func handleSubscribe(ctx *Context) error {
+	theme := ""
+	if ctx.State != nil {
+		theme = ctx.State.SelectedTheme
+	}
+
+	if err := ctx.App.Store.Subscribe(ctx.UserID, ctx.ChatID, theme); err != nil {
+		return fmt.Errorf("ошибка оформления подписки: %w", err)
+	}
+
+	return ctx.Send("Вы подписались на вопрос дня.")
+}
+
+// Обработка команды /unsubscribe
+func handleUnsubscribe(ctx *Context) error {
+	if err := ctx.App.Store.Unsubscribe(ctx.UserID); err != nil {
+		return fmt.Errorf("ошибка отмены подписки: %w", err)
+	}
+
+	return ctx.Send("Вы отписались от вопроса дня.")
+}
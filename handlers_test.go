@@ -0,0 +1,102 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEqualSet(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b []string
+		want bool
+	}{
+		{"same order", []string{"A", "B"}, []string{"A", "B"}, true},
+		{"different order", []string{"B", "A"}, []string{"A", "B"}, true},
+		{"case insensitive", []string{"a", "b"}, []string{"A", "B"}, true},
+		{"different length", []string{"A"}, []string{"A", "B"}, false},
+		{"different contents", []string{"A", "C"}, []string{"A", "B"}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := equalSet(tc.a, tc.b); got != tc.want {
+				t.Errorf("equalSet(%v, %v) = %v, want %v", tc.a, tc.b, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEqualSequence(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b []string
+		want bool
+	}{
+		{"same order", []string{"A", "B", "C"}, []string{"A", "B", "C"}, true},
+		{"different order", []string{"B", "A", "C"}, []string{"A", "B", "C"}, false},
+		{"case insensitive", []string{"a", "b"}, []string{"A", "B"}, true},
+		{"different length", []string{"A", "B"}, []string{"A", "B", "C"}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := equalSequence(tc.a, tc.b); got != tc.want {
+				t.Errorf("equalSequence(%v, %v) = %v, want %v", tc.a, tc.b, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestToggleKey(t *testing.T) {
+	keys := toggleKey(nil, "A")
+	if !reflect.DeepEqual(keys, []string{"A"}) {
+		t.Fatalf("toggleKey(nil, \"A\") = %v, want [A]", keys)
+	}
+
+	keys = toggleKey(keys, "B")
+	if !reflect.DeepEqual(keys, []string{"A", "B"}) {
+		t.Fatalf("after adding B: %v, want [A B]", keys)
+	}
+
+	keys = toggleKey(keys, "A")
+	if !reflect.DeepEqual(keys, []string{"B"}) {
+		t.Fatalf("after removing A: %v, want [B]", keys)
+	}
+}
+
+func TestExtractToggleKey(t *testing.T) {
+	key, ok := extractToggleKey("toggle_A")
+	if !ok || key != "A" {
+		t.Errorf("extractToggleKey(\"toggle_A\") = (%q, %v), want (\"A\", true)", key, ok)
+	}
+
+	if _, ok := extractToggleKey("submit_answer"); ok {
+		t.Error("extractToggleKey(\"submit_answer\") = ok=true, want false")
+	}
+}
+
+func TestContains(t *testing.T) {
+	if !contains([]string{"A", "b"}, "B") {
+		t.Error("contains should be case-insensitive")
+	}
+	if contains([]string{"A"}, "B") {
+		t.Error("contains(\"A\" set, \"B\") = true, want false")
+	}
+}
+
+func TestOptionKeysStableOrderWithoutShuffle(t *testing.T) {
+	q := Question{
+		Options: map[string]Option{
+			"C": {Text: textRu("c")},
+			"A": {Text: textRu("a")},
+			"B": {Text: textRu("b")},
+		},
+	}
+
+	got := optionKeys(q)
+	want := []string{"A", "B", "C"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("optionKeys() = %v, want %v", got, want)
+	}
+}
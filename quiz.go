@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// defaultLanguage — язык, на котором вопросы показываются по умолчанию.
+const defaultLanguage = "ru"
+
+// LocalizedText хранит перевод текста по кодам языка ("ru", "en", ...).
+type LocalizedText map[string]string
+
+// Get возвращает перевод на языке lang, откатываясь на defaultLanguage, а затем
+// на любой доступный перевод.
+func (t LocalizedText) Get(lang string) string {
+	if text, ok := t[lang]; ok {
+		return text
+	}
+	if text, ok := t[defaultLanguage]; ok {
+		return text
+	}
+	for _, text := range t {
+		return text
+	}
+	return ""
+}
+
+// QuestionType определяет формат ответа на вопрос.
+type QuestionType string
+
+const (
+	TypeSingle   QuestionType = "single"
+	TypeMulti    QuestionType = "multi"
+	TypeFreeText QuestionType = "free_text"
+	TypeOrdering QuestionType = "ordering"
+)
+
+// Option — один вариант ответа с локализованным текстом и необязательным
+// пояснением, которое показывается пользователю после ответа.
+type Option struct {
+	Text        LocalizedText `json:"text"`
+	Explanation LocalizedText `json:"explanation,omitempty"`
+}
+
+// Структура вопроса
+type Question struct {
+	Id             int               `json:"id"`
+	Type           QuestionType      `json:"type"`
+	Question       LocalizedText     `json:"question"`
+	Image          string            `json:"image,omitempty"`
+	Audio          string            `json:"audio,omitempty"`
+	Options        map[string]Option `json:"options,omitempty"`
+	CorrectAnswer  []string          `json:"correct_answer"`
+	ShuffleOptions bool              `json:"shuffle_options,omitempty"`
+	Difficulty     string            `json:"difficulty,omitempty"`
+	Tags           []string          `json:"tags,omitempty"`
+}
+
+// quizFile — формат одного JSON-файла с темой: тема называется по полю title,
+// а не по имени файла.
+type quizFile struct {
+	Title     string     `json:"title"`
+	Questions []Question `json:"questions"`
+}
+
+// QuestionManager хранит загруженные темы и защищает их мьютексом, чтобы
+// горячая перезагрузка (/reload, fsnotify) не мешала вопросам, которые в этот
+// момент показываются в уже идущих викторинах.
+type QuestionManager struct {
+	mu     sync.RWMutex
+	Themes map[string][]Question
+}
+
+func NewQuestionManager() *QuestionManager {
+	return &QuestionManager{
+		Themes: make(map[string][]Question),
+	}
+}
+
+// Theme возвращает вопросы темы name и true, если такая тема загружена.
+func (qm *QuestionManager) Theme(name string) ([]Question, bool) {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+	questions, ok := qm.Themes[name]
+	return questions, ok
+}
+
+// ThemeNames возвращает названия всех загруженных тем.
+func (qm *QuestionManager) ThemeNames() []string {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+	names := make([]string, 0, len(qm.Themes))
+	for name := range qm.Themes {
+		names = append(names, name)
+	}
+	return names
+}
+
+// ThemeCounts возвращает число загруженных вопросов в каждой теме.
+func (qm *QuestionManager) ThemeCounts() map[string]int {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+	counts := make(map[string]int, len(qm.Themes))
+	for name, questions := range qm.Themes {
+		counts[name] = len(questions)
+	}
+	return counts
+}
+
+// AllQuestions возвращает вопросы всех тем одним срезом.
+func (qm *QuestionManager) AllQuestions() []Question {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+	var all []Question
+	for _, questions := range qm.Themes {
+		all = append(all, questions...)
+	}
+	return all
+}
+
+// QuestionByID возвращает вопрос темы name с заданным id — используется
+// сессией повторения, которая ссылается на вопросы по сохранённым ранее id,
+// а не по индексу в срезе темы.
+func (qm *QuestionManager) QuestionByID(name string, id int) (Question, bool) {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+	for _, q := range qm.Themes[name] {
+		if q.Id == id {
+			return q, true
+		}
+	}
+	return Question{}, false
+}
+
+// RandomTheme возвращает вопросы произвольной загруженной темы — используется
+// для "вопроса дня", если у подписчика нет своей темы или она недоступна.
+func (qm *QuestionManager) RandomTheme() []Question {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+	for _, questions := range qm.Themes {
+		return questions
+	}
+	return nil
+}
+
+// loadQuestionFile читает и валидирует один файл темы, возвращая её название
+// (из поля title) и отфильтрованный список вопросов.
+func loadQuestionFile(filename string) (string, []Question, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", nil, fmt.Errorf("ошибка при чтении файла: %w", err)
+	}
+
+	var qf quizFile
+	if err := json.Unmarshal(data, &qf); err != nil {
+		return "", nil, fmt.Errorf("ошибка при разборе JSON: %w", err)
+	}
+
+	if strings.TrimSpace(qf.Title) == "" {
+		return "", nil, fmt.Errorf("в файле %s не задано поле title", filename)
+	}
+
+	valid, problems := validateQuestions(qf.Questions)
+	for _, problem := range problems {
+		log.Printf("Предупреждение в файле %s: %s", filename, problem)
+	}
+	if len(problems) > 0 {
+		log.Printf("Тема %q: из %d вопрос(ов) загружено %d, отклонено %d",
+			qf.Title, len(qf.Questions), len(valid), len(problems))
+	}
+
+	if len(valid) == 0 {
+		return "", nil, fmt.Errorf("в файле %s не осталось ни одного валидного вопроса", filename)
+	}
+
+	return qf.Title, valid, nil
+}
+
+// validateQuestions проверяет вопросы файла и возвращает только корректные, а
+// также человекочитаемые описания отклонённых вопросов.
+func validateQuestions(questions []Question) (valid []Question, problems []string) {
+	seenIDs := make(map[int]bool)
+
+	for _, q := range questions {
+		if seenIDs[q.Id] {
+			problems = append(problems, fmt.Sprintf("вопрос id=%d: дублирующийся id", q.Id))
+			continue
+		}
+
+		if q.Question.Get(defaultLanguage) == "" {
+			problems = append(problems, fmt.Sprintf("вопрос id=%d: пустой текст вопроса", q.Id))
+			continue
+		}
+
+		if q.Type == "" {
+			q.Type = TypeSingle
+		}
+
+		if len(q.CorrectAnswer) == 0 {
+			problems = append(problems, fmt.Sprintf("вопрос id=%d: не указан правильный ответ", q.Id))
+			continue
+		}
+
+		needsOptions := q.Type == TypeSingle || q.Type == TypeMulti || q.Type == TypeOrdering
+		if needsOptions {
+			if len(q.Options) == 0 {
+				problems = append(problems, fmt.Sprintf("вопрос id=%d: список вариантов пуст", q.Id))
+				continue
+			}
+
+			unknownKey := ""
+			for _, key := range q.CorrectAnswer {
+				if _, ok := q.Options[key]; !ok {
+					unknownKey = key
+					break
+				}
+			}
+			if unknownKey != "" {
+				problems = append(problems, fmt.Sprintf("вопрос id=%d: правильный ответ %q не найден среди вариантов", q.Id, unknownKey))
+				continue
+			}
+		}
+
+		seenIDs[q.Id] = true
+		valid = append(valid, q)
+	}
+
+	return valid, problems
+}
+
+// LoadAllQuestionsFromDir читает все файлы тем из dirPath и атомарно заменяет
+// ими Themes: частично загруженные или невалидные файлы не попадают в
+// результат, но не прерывают загрузку остальных.
+func (qm *QuestionManager) LoadAllQuestionsFromDir(dirPath string) error {
+	info, err := os.Stat(dirPath)
+	if err != nil {
+		return fmt.Errorf("ошибка при доступе к директории %s: %w", dirPath, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s не является директорией", dirPath)
+	}
+
+	files, err := os.ReadDir(dirPath)
+	if err != nil {
+		return fmt.Errorf("ошибка при чтении директории %s: %w", dirPath, err)
+	}
+
+	themes := make(map[string][]Question)
+	for _, file := range files {
+		if file.IsDir() {
+			continue // Пропуск поддиректорий, если необходимо
+		}
+
+		if strings.ToLower(filepath.Ext(file.Name())) != ".json" {
+			continue // Пропуск файлов с другими расширениями
+		}
+
+		filePath := filepath.Join(dirPath, file.Name())
+		title, questions, err := loadQuestionFile(filePath)
+		if err != nil {
+			log.Printf("Предупреждение: %v", err)
+			continue
+		}
+
+		themes[title] = questions
+		log.Printf("Загружена тема: %s из файла %s", title, file.Name())
+	}
+
+	qm.mu.Lock()
+	qm.Themes = themes
+	qm.mu.Unlock()
+
+	return nil
+}
+
+// Reload — синоним LoadAllQuestionsFromDir для вызова поверх уже работающего
+// бота (из /reload или наблюдателя fsnotify): подчёркивает, что живые
+// викторины не видят частично загруженных тем благодаря атомарной подмене.
+func (qm *QuestionManager) Reload(dirPath string) error {
+	return qm.LoadAllQuestionsFromDir(dirPath)
+}
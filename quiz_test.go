@@ -0,0 +1,159 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func textRu(s string) LocalizedText {
+	return LocalizedText{"ru": s}
+}
+
+func TestValidateQuestionsRejectsDuplicateID(t *testing.T) {
+	questions := []Question{
+		{Id: 1, Type: TypeSingle, Question: textRu("Вопрос 1"), Options: map[string]Option{"A": {Text: textRu("A")}}, CorrectAnswer: []string{"A"}},
+		{Id: 1, Type: TypeSingle, Question: textRu("Вопрос 2"), Options: map[string]Option{"A": {Text: textRu("A")}}, CorrectAnswer: []string{"A"}},
+	}
+
+	valid, problems := validateQuestions(questions)
+	if len(valid) != 1 {
+		t.Fatalf("len(valid) = %d, want 1 (second question has a duplicate id)", len(valid))
+	}
+	if len(problems) != 1 {
+		t.Fatalf("len(problems) = %d, want 1", len(problems))
+	}
+}
+
+func TestValidateQuestionsRejectsEmptyText(t *testing.T) {
+	questions := []Question{
+		{Id: 1, Type: TypeSingle, Question: LocalizedText{}, Options: map[string]Option{"A": {Text: textRu("A")}}, CorrectAnswer: []string{"A"}},
+	}
+
+	valid, problems := validateQuestions(questions)
+	if len(valid) != 0 || len(problems) != 1 {
+		t.Fatalf("valid=%d problems=%d, want 0 and 1 for a question with empty text", len(valid), len(problems))
+	}
+}
+
+func TestValidateQuestionsRejectsMissingCorrectAnswer(t *testing.T) {
+	questions := []Question{
+		{Id: 1, Type: TypeSingle, Question: textRu("Вопрос"), Options: map[string]Option{"A": {Text: textRu("A")}}},
+	}
+
+	valid, problems := validateQuestions(questions)
+	if len(valid) != 0 || len(problems) != 1 {
+		t.Fatalf("valid=%d problems=%d, want 0 and 1 for a question without correct_answer", len(valid), len(problems))
+	}
+}
+
+func TestValidateQuestionsRejectsEmptyOptionsWhenRequired(t *testing.T) {
+	for _, qType := range []QuestionType{TypeSingle, TypeMulti, TypeOrdering} {
+		questions := []Question{
+			{Id: 1, Type: qType, Question: textRu("Вопрос"), CorrectAnswer: []string{"A"}},
+		}
+
+		valid, problems := validateQuestions(questions)
+		if len(valid) != 0 || len(problems) != 1 {
+			t.Errorf("type %s: valid=%d problems=%d, want 0 and 1 for a question with no options", qType, len(valid), len(problems))
+		}
+	}
+}
+
+func TestValidateQuestionsRejectsUnknownCorrectAnswerKey(t *testing.T) {
+	questions := []Question{
+		{Id: 1, Type: TypeSingle, Question: textRu("Вопрос"), Options: map[string]Option{"A": {Text: textRu("A")}}, CorrectAnswer: []string{"B"}},
+	}
+
+	valid, problems := validateQuestions(questions)
+	if len(valid) != 0 || len(problems) != 1 {
+		t.Fatalf("valid=%d problems=%d, want 0 and 1 when correct_answer references an unknown option", len(valid), len(problems))
+	}
+}
+
+func TestValidateQuestionsDefaultsTypeToSingle(t *testing.T) {
+	questions := []Question{
+		{Id: 1, Question: textRu("Вопрос"), Options: map[string]Option{"A": {Text: textRu("A")}}, CorrectAnswer: []string{"A"}},
+	}
+
+	valid, problems := validateQuestions(questions)
+	if len(problems) != 0 {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+	if len(valid) != 1 || valid[0].Type != TypeSingle {
+		t.Fatalf("question without an explicit type should default to TypeSingle, got %+v", valid)
+	}
+}
+
+func TestValidateQuestionsFreeTextDoesNotNeedOptions(t *testing.T) {
+	questions := []Question{
+		{Id: 1, Type: TypeFreeText, Question: textRu("Вопрос"), CorrectAnswer: []string{"ответ"}},
+	}
+
+	valid, problems := validateQuestions(questions)
+	if len(problems) != 0 || len(valid) != 1 {
+		t.Fatalf("valid=%d problems=%v, want 1 valid question with no problems for free_text", len(valid), problems)
+	}
+}
+
+func TestLoadQuestionFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "theme.json")
+	content := `{
+		"title": "Тестовая тема",
+		"questions": [
+			{"id": 1, "type": "single", "question": {"ru": "1+1?"}, "options": {"A": {"text": {"ru": "2"}}, "B": {"text": {"ru": "3"}}}, "correct_answer": ["A"]}
+		]
+	}`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	title, questions, err := loadQuestionFile(path)
+	if err != nil {
+		t.Fatalf("loadQuestionFile() error = %v", err)
+	}
+	if title != "Тестовая тема" {
+		t.Errorf("title = %q, want %q", title, "Тестовая тема")
+	}
+	if len(questions) != 1 {
+		t.Fatalf("len(questions) = %d, want 1", len(questions))
+	}
+}
+
+func TestLoadQuestionFileMissingTitle(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "theme.json")
+	if err := os.WriteFile(path, []byte(`{"questions": []}`), 0o644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	if _, _, err := loadQuestionFile(path); err == nil {
+		t.Error("loadQuestionFile() error = nil, want an error for a file without a title")
+	}
+}
+
+func TestLoadQuestionFileInvalidJSON(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "theme.json")
+	if err := os.WriteFile(path, []byte(`{not json`), 0o644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	if _, _, err := loadQuestionFile(path); err == nil {
+		t.Error("loadQuestionFile() error = nil, want an error for invalid JSON")
+	}
+}
+
+func TestLoadQuestionFileNoValidQuestions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "theme.json")
+	content := `{"title": "Тема", "questions": [{"id": 1, "question": {"ru": ""}}]}`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	if _, _, err := loadQuestionFile(path); err == nil {
+		t.Error("loadQuestionFile() error = nil, want an error when every question is rejected")
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// reviewItem — один вопрос сессии повторения вместе с разрешённым Question.
+type reviewItem struct {
+	Theme    string
+	Question Question
+}
+
+// ReviewSession — сессия повторения ранее отвеченных вопросов по алгоритму
+// SM-2. В отличие от UserState, живёт только в памяти — сессия короткая и не
+// должна переживать перезапуск бота.
+type ReviewSession struct {
+	Items []reviewItem
+	Index int
+
+	mu sync.Mutex
+}
+
+// ReviewManager хранит активные сессии повторения, не более одной на пользователя.
+type ReviewManager struct {
+	mu       sync.Mutex
+	sessions map[int64]*ReviewSession
+}
+
+// NewReviewManager создаёт пустой менеджер сессий повторения.
+func NewReviewManager() *ReviewManager {
+	return &ReviewManager{sessions: make(map[int64]*ReviewSession)}
+}
+
+// Get возвращает активную сессию повторения пользователя, если она есть.
+func (rm *ReviewManager) Get(userID int64) (*ReviewSession, bool) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	s, ok := rm.sessions[userID]
+	return s, ok
+}
+
+// Start создаёт сессию повторения пользователя, если он ещё ни одной не ведёт.
+func (rm *ReviewManager) Start(userID int64, items []reviewItem) (*ReviewSession, error) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if _, exists := rm.sessions[userID]; exists {
+		return nil, fmt.Errorf("у вас уже идёт сессия повторения")
+	}
+
+	session := &ReviewSession{Items: items}
+	rm.sessions[userID] = session
+	return session, nil
+}
+
+// Remove удаляет сессию повторения пользователя.
+func (rm *ReviewManager) Remove(userID int64) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	delete(rm.sessions, userID)
+}
+
+// reviewQuality переводит результат ответа в оценку качества SM-2 (0..5).
+// Бот не показывает подсказок, поэтому используются только два полюса шкалы:
+// неверный ответ (2) и верный ответ с первой попытки (5).
+func reviewQuality(correct bool) int {
+	if correct {
+		return 5
+	}
+	return 2
+}
+
+// handleReviewStart обрабатывает команду /review: начинает сессию повторения
+// вопросов, срок которых по алгоритму SM-2 уже настал.
+func handleReviewStart(ctx *Context) error {
+	due, err := ctx.App.Store.DueItems(ctx.UserID)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения вопросов к повторению: %w", err)
+	}
+
+	var items []reviewItem
+	for _, record := range due {
+		q, ok := ctx.App.QuestionMgr.QuestionByID(record.Theme, record.QuestionID)
+		if !ok || q.Type != TypeSingle {
+			// Вопрос удалён/изменён либо относится к типу, который сессия
+			// повторения пока не умеет переспрашивать. Запись в reviews не
+			// трогаем — она предложится снова при следующем /review.
+			continue
+		}
+		items = append(items, reviewItem{Theme: record.Theme, Question: q})
+	}
+
+	if len(items) == 0 {
+		nextDue, hasNext, err := ctx.App.Store.NextDueAfter(ctx.UserID)
+		if err != nil {
+			return fmt.Errorf("ошибка чтения времени следующего повторения: %w", err)
+		}
+		if !hasNext {
+			return ctx.Send("Повторять пока нечего — отвечайте на вопросы викторин, чтобы они попали в расписание.")
+		}
+		return ctx.Send(fmt.Sprintf("Сейчас повторять нечего. Следующее повторение: %s", nextDue.Format("02.01.2006 15:04")))
+	}
+
+	session, err := ctx.App.Reviews.Start(ctx.UserID, items)
+	if err != nil {
+		return ctx.Send(err.Error())
+	}
+
+	if err := ctx.Send(fmt.Sprintf("Сессия повторения: %d вопрос(ов).", len(items))); err != nil {
+		log.Printf("Ошибка при отправке сообщения: %v", err)
+	}
+
+	return ctx.renderReviewQuestion(session)
+}
+
+// renderReviewQuestion отправляет текущий вопрос сессии повторения.
+func (ctx *Context) renderReviewQuestion(session *ReviewSession) error {
+	session.mu.Lock()
+	q := session.Items[session.Index].Question
+	session.mu.Unlock()
+
+	keys := optionKeys(q)
+
+	text := "*" + q.Question.Get(defaultLanguage) + "*\n\n"
+	var buttons []tgbotapi.InlineKeyboardButton
+	for _, key := range keys {
+		text += fmt.Sprintf("%s. %s\n", key, q.Options[key].Text.Get(defaultLanguage))
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(key, "review_"+key))
+	}
+
+	msg := tgbotapi.NewMessage(ctx.ChatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons)
+
+	_, err := ctx.App.Bot.Send(msg)
+	return err
+}
+
+// handleReviewAnswer обрабатывает ответ на вопрос сессии повторения: обновляет
+// расписание SM-2 и переходит к следующему вопросу либо завершает сессию.
+func handleReviewAnswer(ctx *Context, data string) error {
+	key := strings.ToUpper(strings.TrimPrefix(data, "review_"))
+
+	session, ok := ctx.App.Reviews.Get(ctx.UserID)
+	if !ok {
+		return nil
+	}
+
+	session.mu.Lock()
+	if session.Index >= len(session.Items) {
+		session.mu.Unlock()
+		return nil
+	}
+	item := session.Items[session.Index]
+	session.Index++
+	done := session.Index >= len(session.Items)
+	session.mu.Unlock()
+
+	correct := contains(item.Question.CorrectAnswer, key)
+	if err := ctx.App.Store.RecordReview(ctx.UserID, item.Theme, item.Question.Id, reviewQuality(correct)); err != nil {
+		log.Printf("Ошибка обновления расписания повторения: %v", err)
+	}
+
+	response := "Неправильно. ❌\n"
+	if correct {
+		response = "Правильно! 👍\n"
+	} else {
+		correctKey := item.Question.CorrectAnswer[0]
+		response += fmt.Sprintf("Правильный ответ: %s: %s\n", correctKey, item.Question.Options[correctKey].Text.Get(defaultLanguage))
+	}
+
+	if _, err := ctx.App.Bot.Send(tgbotapi.NewMessage(ctx.ChatID, response)); err != nil {
+		log.Printf("Ошибка при отправке результата повторения: %v", err)
+	}
+
+	if done {
+		ctx.App.Reviews.Remove(ctx.UserID)
+		return ctx.Send("Сессия повторения завершена.")
+	}
+
+	return ctx.renderReviewQuestion(session)
+}
+
+// handleDue обрабатывает команду /due: показывает число вопросов, которые пора
+// повторить, по темам.
+func handleDue(ctx *Context) error {
+	counts, err := ctx.App.Store.DueCounts(ctx.UserID)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения статистики повторения: %w", err)
+	}
+
+	if len(counts) == 0 {
+		return ctx.Send("Сейчас нет вопросов к повторению. Загляните позже или пройдите /start.")
+	}
+
+	total := 0
+	text := "К повторению:\n"
+	for theme, count := range counts {
+		text += fmt.Sprintf("%s — %d\n", theme, count)
+		total += count
+	}
+	text += fmt.Sprintf("\nВсего: %d. Начать повторение: /review", total)
+
+	return ctx.Send(text)
+}
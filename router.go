@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/issa0sg/quizzer/storage"
+)
+
+// Специальные конечные точки маршрутизатора, не привязанные к конкретной команде.
+// Используют символ, недопустимый в тексте команды, чтобы не пересекаться с ней
+// (тот же приём, что и в telebot v3).
+const (
+	OnText       = "\aon_text"
+	OnCallback   = "\aon_callback"
+	OnPollAnswer = "\aon_poll_answer"
+)
+
+// Context оборачивает входящее обновление вместе с приложением и (если загружено
+// соответствующей middleware) состоянием пользователя, чтобы обработчикам не нужно
+// было напрямую обращаться к App.Bot/App.Store.
+type Context struct {
+	App    *App
+	Update tgbotapi.Update
+	UserID int64
+	ChatID int64
+	State  *storage.UserState
+}
+
+// Data возвращает данные callback-запроса или пустую строку, если его нет.
+func (c *Context) Data() string {
+	if c.Update.CallbackQuery == nil {
+		return ""
+	}
+	return c.Update.CallbackQuery.Data
+}
+
+// PollAnswer возвращает ответ на опрос из обновления или nil, если его нет.
+func (c *Context) PollAnswer() *tgbotapi.PollAnswer {
+	return c.Update.PollAnswer
+}
+
+// Text возвращает текст входящего сообщения или пустую строку.
+func (c *Context) Text() string {
+	if c.Update.Message == nil {
+		return ""
+	}
+	return c.Update.Message.Text
+}
+
+// Send отправляет простое текстовое сообщение в чат обновления.
+func (c *Context) Send(text string) error {
+	_, err := c.App.Bot.Send(tgbotapi.NewMessage(c.ChatID, text))
+	return err
+}
+
+// HandlerFunc — обработчик одной конечной точки маршрутизатора.
+type HandlerFunc func(ctx *Context) error
+
+// MiddlewareFunc оборачивает HandlerFunc дополнительным поведением.
+type MiddlewareFunc func(next HandlerFunc) HandlerFunc
+
+// Router сопоставляет конечные точки (команды, OnText, OnCallback) с обработчиками
+// и прогоняет каждый вызов через цепочку глобальной middleware.
+type Router struct {
+	handlers   map[string]HandlerFunc
+	middleware []MiddlewareFunc
+}
+
+// NewRouter создаёт пустой маршрутизатор.
+func NewRouter() *Router {
+	return &Router{handlers: make(map[string]HandlerFunc)}
+}
+
+// Use добавляет глобальную middleware, применяемую ко всем обработчикам в порядке
+// регистрации (первая добавленная оборачивает все остальные снаружи).
+func (r *Router) Use(mw ...MiddlewareFunc) {
+	r.middleware = append(r.middleware, mw...)
+}
+
+// Handle регистрирует обработчик для конечной точки: имени команды без "/"
+// ("start", "help", ...) либо OnText/OnCallback.
+func (r *Router) Handle(endpoint string, h HandlerFunc) {
+	r.handlers[endpoint] = h
+}
+
+// endpointFor определяет конечную точку для конкретного обновления. Команда в
+// подписи к документу (например, /upload с прикреплённым JSON-файлом) тоже
+// считается командой.
+func endpointFor(update tgbotapi.Update) string {
+	switch {
+	case update.Message != nil && update.Message.IsCommand():
+		return update.Message.Command()
+	case update.Message != nil && update.Message.Document != nil && strings.HasPrefix(update.Message.Caption, "/"):
+		command := strings.TrimPrefix(strings.Fields(update.Message.Caption)[0], "/")
+		if i := strings.Index(command, "@"); i >= 0 {
+			command = command[:i]
+		}
+		return command
+	case update.CallbackQuery != nil:
+		return OnCallback
+	case update.PollAnswer != nil:
+		return OnPollAnswer
+	case update.Message != nil:
+		return OnText
+	default:
+		return ""
+	}
+}
+
+// Dispatch находит обработчик для обновления, оборачивает его зарегистрированной
+// middleware и выполняет.
+func (r *Router) Dispatch(app *App, update tgbotapi.Update) error {
+	endpoint := endpointFor(update)
+	if endpoint == "" {
+		return nil
+	}
+
+	handler, ok := r.handlers[endpoint]
+	if !ok {
+		handler = func(ctx *Context) error {
+			return ctx.Send("Неизвестная команда. Используйте /help для списка доступных команд.")
+		}
+	}
+
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		handler = r.middleware[i](handler)
+	}
+
+	ctx := &Context{App: app, Update: update}
+	switch {
+	case update.Message != nil:
+		ctx.UserID = update.Message.From.ID
+		ctx.ChatID = update.Message.Chat.ID
+	case update.CallbackQuery != nil:
+		ctx.UserID = update.CallbackQuery.From.ID
+		ctx.ChatID = update.CallbackQuery.Message.Chat.ID
+	case update.PollAnswer != nil:
+		// PollAnswer не содержит chat id — чат для попытки находится через
+		// App.Polls по идентификатору опроса.
+		ctx.UserID = update.PollAnswer.User.ID
+	}
+
+	return handler(ctx)
+}
+
+// LoggerMiddleware логирует конечную точку и пользователя каждого обновления.
+func LoggerMiddleware(next HandlerFunc) HandlerFunc {
+	return func(ctx *Context) error {
+		endpoint := endpointFor(ctx.Update)
+		err := next(ctx)
+		if err != nil {
+			log.Printf("[%s] пользователь %d: %v", endpoint, ctx.UserID, err)
+		} else {
+			log.Printf("[%s] пользователь %d: ok", endpoint, ctx.UserID)
+		}
+		return err
+	}
+}
+
+// RecoverMiddleware перехватывает панику в обработчике, логирует её и
+// не даёт уронить весь цикл обработки обновлений.
+func RecoverMiddleware(next HandlerFunc) HandlerFunc {
+	return func(ctx *Context) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("паника в обработчике пользователя %d: %v", ctx.UserID, r)
+				err = fmt.Errorf("паника в обработчике: %v", r)
+			}
+		}()
+		return next(ctx)
+	}
+}
+
+// RateLimitMiddleware ограничивает частоту запросов от одного пользователя.
+func RateLimitMiddleware(minInterval time.Duration) MiddlewareFunc {
+	var mu sync.Mutex
+	last := make(map[int64]time.Time)
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) error {
+			mu.Lock()
+			prev, seen := last[ctx.UserID]
+			now := time.Now()
+			if seen && now.Sub(prev) < minInterval {
+				mu.Unlock()
+				return nil
+			}
+			last[ctx.UserID] = now
+			mu.Unlock()
+
+			return next(ctx)
+		}
+	}
+}
+
+// WithUserStateMiddleware загружает UserState пользователя до вызова обработчика и
+// сохраняет его после — под защитой App.mu, — чтобы сами обработчики не трогали
+// мьютекс напрямую. Обработчик может установить ctx.State = nil, чтобы явно
+// пропустить сохранение (например, после удаления состояния).
+func WithUserStateMiddleware(next HandlerFunc) HandlerFunc {
+	return func(ctx *Context) error {
+		ctx.App.mu.Lock()
+		defer ctx.App.mu.Unlock()
+
+		state, exists, err := ctx.App.Store.LoadUserState(ctx.UserID)
+		if err != nil {
+			return fmt.Errorf("ошибка чтения состояния пользователя %d: %w", ctx.UserID, err)
+		}
+		if exists {
+			ctx.State = state
+		}
+
+		if err := next(ctx); err != nil {
+			return err
+		}
+
+		if ctx.State == nil {
+			return nil
+		}
+
+		return ctx.App.Store.SaveUserState(ctx.State)
+	}
+}
+
+// extractCallbackTheme — небольшой помощник, оставшийся от предыдущей
+// реализации, чтобы не дублировать разбор префикса "theme_" в обработчике callback.
+func extractCallbackTheme(data string) (theme string, ok bool) {
+	if !strings.HasPrefix(data, "theme_") {
+		return "", false
+	}
+	return strings.TrimPrefix(data, "theme_"), true
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func commandUpdate(text string) tgbotapi.Update {
+	return tgbotapi.Update{
+		Message: &tgbotapi.Message{
+			Text:     text,
+			Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(text)}},
+		},
+	}
+}
+
+func TestEndpointFor(t *testing.T) {
+	cases := []struct {
+		name   string
+		update tgbotapi.Update
+		want   string
+	}{
+		{"command", commandUpdate("/start"), "start"},
+		{"callback", tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{Data: "theme_foo"}}, OnCallback},
+		{"poll answer", tgbotapi.Update{PollAnswer: &tgbotapi.PollAnswer{PollID: "1"}}, OnPollAnswer},
+		{"plain text", tgbotapi.Update{Message: &tgbotapi.Message{Text: "hello"}}, OnText},
+		{"empty update", tgbotapi.Update{}, ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := endpointFor(tc.update); got != tc.want {
+				t.Errorf("endpointFor() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExtractCallbackTheme(t *testing.T) {
+	if theme, ok := extractCallbackTheme("theme_История"); !ok || theme != "История" {
+		t.Errorf("extractCallbackTheme() = (%q, %v), want (\"История\", true)", theme, ok)
+	}
+
+	if _, ok := extractCallbackTheme("order_random"); ok {
+		t.Error("extractCallbackTheme() = ok=true for data without the theme_ prefix")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	calls := 0
+	handler := RateLimitMiddleware(50 * time.Millisecond)(func(ctx *Context) error {
+		calls++
+		return nil
+	})
+
+	ctx := &Context{UserID: 1}
+
+	if err := handler(ctx); err != nil {
+		t.Fatalf("first call: unexpected error: %v", err)
+	}
+	if err := handler(ctx); err != nil {
+		t.Fatalf("second call: unexpected error: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1 (second call within minInterval should be dropped)", calls)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := handler(ctx); err != nil {
+		t.Fatalf("third call: unexpected error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2 (call after minInterval should go through)", calls)
+	}
+
+	// Другой пользователь не должен зависеть от лимита первого.
+	otherCtx := &Context{UserID: 2}
+	if err := handler(otherCtx); err != nil {
+		t.Fatalf("other user call: unexpected error: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3 (different user should not be rate-limited)", calls)
+	}
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	handler := RecoverMiddleware(func(ctx *Context) error {
+		panic("boom")
+	})
+
+	err := handler(&Context{UserID: 1})
+	if err == nil {
+		t.Fatal("RecoverMiddleware() did not convert panic into an error")
+	}
+}
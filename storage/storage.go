@@ -0,0 +1,527 @@
+// Package storage хранит состояние пользователей и результаты викторин в SQLite,
+// чтобы они переживали перезапуск бота.
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// UserState — состояние пользователя, ранее хранившееся только в App.Users.
+type UserState struct {
+	UserID          int64
+	AttemptID       int64
+	CurrentQuestion int
+	Score           int
+	QuestionOrder   []int
+	SelectedTheme   string
+	SetupStep       string
+	// PendingAnswers — варианты, уже отмеченные пользователем в текущем вопросе
+	// с множественным выбором или вопросе на упорядочивание (до нажатия "Отправить").
+	PendingAnswers []string
+	// RenderMode — способ показа вопросов с одним правильным ответом: "" для
+	// обычных инлайн-кнопок, "poll" для нативного quiz-опроса Telegram.
+	RenderMode string
+}
+
+// ThemeStat — агрегированная статистика ответов пользователя по одной теме.
+type ThemeStat struct {
+	Theme     string
+	Correct   int
+	Incorrect int
+}
+
+// QuestionStat — агрегированная статистика ответов пользователя по одному
+// вопросу конкретной темы. Сложность вопроса (Question.Difficulty) в схему
+// answers не попадает — она берётся из текущего QuestionManager и
+// примешивается к этой статистике на уровне обработчика команды.
+type QuestionStat struct {
+	Theme      string
+	QuestionID int
+	Correct    int
+	Incorrect  int
+}
+
+// Attempt — одна завершённая (или текущая) попытка прохождения викторины.
+type Attempt struct {
+	ID         int64
+	Theme      string
+	Score      int
+	Total      int
+	StartedAt  time.Time
+	FinishedAt sql.NullTime
+}
+
+// ReviewItem — запись повторения вопроса по алгоритму SM-2 для пары
+// (пользователь, вопрос).
+type ReviewItem struct {
+	UserID       int64
+	QuestionID   int
+	Theme        string
+	Repetitions  int
+	Easiness     float64
+	IntervalDays int
+	NextDue      time.Time
+}
+
+// Subscription — подписка пользователя на "вопрос дня".
+type Subscription struct {
+	UserID int64
+	ChatID int64
+	Theme  string
+}
+
+// Store — обёртка над database/sql для персистентности бота.
+type Store struct {
+	db *sql.DB
+}
+
+// New открывает (и при необходимости создаёт) файл базы данных SQLite по пути path
+// и применяет схему.
+func New(path string) (*Store, error) {
+	db, err := sql.Open("sqlite3", path+"?_foreign_keys=on")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия базы данных %s: %w", path, err)
+	}
+
+	s := &Store{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ошибка применения миграций: %w", err)
+	}
+
+	return s, nil
+}
+
+// Close закрывает соединение с базой данных.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) migrate() error {
+	schema := []string{
+		`CREATE TABLE IF NOT EXISTS user_state (
+			user_id INTEGER PRIMARY KEY,
+			attempt_id INTEGER NOT NULL DEFAULT 0,
+			current_question INTEGER NOT NULL DEFAULT 0,
+			score INTEGER NOT NULL DEFAULT 0,
+			question_order TEXT NOT NULL DEFAULT '[]',
+			selected_theme TEXT NOT NULL DEFAULT '',
+			setup_step TEXT NOT NULL DEFAULT '',
+			pending_answers TEXT NOT NULL DEFAULT '[]',
+			render_mode TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE TABLE IF NOT EXISTS attempts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			theme TEXT NOT NULL,
+			score INTEGER NOT NULL DEFAULT 0,
+			total INTEGER NOT NULL DEFAULT 0,
+			started_at DATETIME NOT NULL,
+			finished_at DATETIME
+		)`,
+		`CREATE TABLE IF NOT EXISTS answers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			attempt_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			theme TEXT NOT NULL,
+			question_id INTEGER NOT NULL,
+			selected TEXT NOT NULL,
+			correct INTEGER NOT NULL,
+			answered_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS subscriptions (
+			user_id INTEGER PRIMARY KEY,
+			chat_id INTEGER NOT NULL,
+			theme TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS reviews (
+			user_id INTEGER NOT NULL,
+			question_id INTEGER NOT NULL,
+			theme TEXT NOT NULL,
+			repetitions INTEGER NOT NULL DEFAULT 0,
+			easiness REAL NOT NULL DEFAULT 2.5,
+			interval_days INTEGER NOT NULL DEFAULT 0,
+			next_due DATETIME NOT NULL,
+			PRIMARY KEY (user_id, question_id)
+		)`,
+	}
+
+	for _, stmt := range schema {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return fmt.Errorf("ошибка выполнения миграции %q: %w", stmt, err)
+		}
+	}
+
+	return nil
+}
+
+// LoadUserState возвращает сохранённое состояние пользователя. Если состояния нет,
+// возвращает exists=false.
+func (s *Store) LoadUserState(userID int64) (state *UserState, exists bool, err error) {
+	row := s.db.QueryRow(`SELECT user_id, attempt_id, current_question, score, question_order, selected_theme, setup_step, pending_answers, render_mode
+		FROM user_state WHERE user_id = ?`, userID)
+
+	var order, pending string
+	st := &UserState{}
+	if err := row.Scan(&st.UserID, &st.AttemptID, &st.CurrentQuestion, &st.Score, &order, &st.SelectedTheme, &st.SetupStep, &pending, &st.RenderMode); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("ошибка чтения состояния пользователя %d: %w", userID, err)
+	}
+
+	if err := json.Unmarshal([]byte(order), &st.QuestionOrder); err != nil {
+		return nil, false, fmt.Errorf("ошибка разбора порядка вопросов пользователя %d: %w", userID, err)
+	}
+	if err := json.Unmarshal([]byte(pending), &st.PendingAnswers); err != nil {
+		return nil, false, fmt.Errorf("ошибка разбора отмеченных вариантов пользователя %d: %w", userID, err)
+	}
+
+	return st, true, nil
+}
+
+// SaveUserState сохраняет (создаёт или обновляет) состояние пользователя.
+func (s *Store) SaveUserState(state *UserState) error {
+	order, err := json.Marshal(state.QuestionOrder)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации порядка вопросов: %w", err)
+	}
+
+	pending, err := json.Marshal(state.PendingAnswers)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации отмеченных вариантов: %w", err)
+	}
+
+	_, err = s.db.Exec(`INSERT INTO user_state (user_id, attempt_id, current_question, score, question_order, selected_theme, setup_step, pending_answers, render_mode)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			attempt_id = excluded.attempt_id,
+			current_question = excluded.current_question,
+			score = excluded.score,
+			question_order = excluded.question_order,
+			selected_theme = excluded.selected_theme,
+			setup_step = excluded.setup_step,
+			pending_answers = excluded.pending_answers,
+			render_mode = excluded.render_mode`,
+		state.UserID, state.AttemptID, state.CurrentQuestion, state.Score, string(order), state.SelectedTheme, state.SetupStep, string(pending), state.RenderMode)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения состояния пользователя %d: %w", state.UserID, err)
+	}
+
+	return nil
+}
+
+// DeleteUserState удаляет состояние пользователя (после завершения викторины).
+func (s *Store) DeleteUserState(userID int64) error {
+	if _, err := s.db.Exec(`DELETE FROM user_state WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("ошибка удаления состояния пользователя %d: %w", userID, err)
+	}
+	return nil
+}
+
+// StartAttempt регистрирует начало новой попытки прохождения викторины и возвращает её id.
+func (s *Store) StartAttempt(userID int64, theme string) (int64, error) {
+	res, err := s.db.Exec(`INSERT INTO attempts (user_id, theme, started_at) VALUES (?, ?, ?)`,
+		userID, theme, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("ошибка создания попытки для пользователя %d: %w", userID, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения id попытки: %w", err)
+	}
+
+	return id, nil
+}
+
+// FinishAttempt фиксирует итоговый счёт и время завершения попытки.
+func (s *Store) FinishAttempt(attemptID int64, score, total int) error {
+	_, err := s.db.Exec(`UPDATE attempts SET score = ?, total = ?, finished_at = ? WHERE id = ?`,
+		score, total, time.Now(), attemptID)
+	if err != nil {
+		return fmt.Errorf("ошибка завершения попытки %d: %w", attemptID, err)
+	}
+	return nil
+}
+
+// RecordAnswer сохраняет ответ пользователя на конкретный вопрос попытки.
+func (s *Store) RecordAnswer(attemptID, userID int64, theme string, questionID int, selected string, correct bool) error {
+	_, err := s.db.Exec(`INSERT INTO answers (attempt_id, user_id, theme, question_id, selected, correct, answered_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		attemptID, userID, theme, questionID, selected, correct, time.Now())
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения ответа пользователя %d: %w", userID, err)
+	}
+	return nil
+}
+
+// ThemeStats возвращает по каждой теме, в которой пользователь отвечал на вопросы,
+// число верных и неверных ответов.
+func (s *Store) ThemeStats(userID int64) ([]ThemeStat, error) {
+	rows, err := s.db.Query(`SELECT theme,
+			SUM(CASE WHEN correct = 1 THEN 1 ELSE 0 END) AS correct,
+			SUM(CASE WHEN correct = 0 THEN 1 ELSE 0 END) AS incorrect
+		FROM answers WHERE user_id = ? GROUP BY theme ORDER BY theme`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения статистики пользователя %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	var stats []ThemeStat
+	for rows.Next() {
+		var st ThemeStat
+		if err := rows.Scan(&st.Theme, &st.Correct, &st.Incorrect); err != nil {
+			return nil, fmt.Errorf("ошибка чтения строки статистики: %w", err)
+		}
+		stats = append(stats, st)
+	}
+
+	return stats, rows.Err()
+}
+
+// QuestionStats возвращает по каждому вопросу, на который пользователь
+// отвечал, число верных и неверных ответов — используется для разбивки
+// точности по сложности вопроса (сложность примешивается из QuestionManager).
+func (s *Store) QuestionStats(userID int64) ([]QuestionStat, error) {
+	rows, err := s.db.Query(`SELECT theme, question_id,
+			SUM(CASE WHEN correct = 1 THEN 1 ELSE 0 END) AS correct,
+			SUM(CASE WHEN correct = 0 THEN 1 ELSE 0 END) AS incorrect
+		FROM answers WHERE user_id = ? GROUP BY theme, question_id ORDER BY theme, question_id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения статистики по вопросам пользователя %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	var stats []QuestionStat
+	for rows.Next() {
+		var st QuestionStat
+		if err := rows.Scan(&st.Theme, &st.QuestionID, &st.Correct, &st.Incorrect); err != nil {
+			return nil, fmt.Errorf("ошибка чтения строки статистики по вопросам: %w", err)
+		}
+		stats = append(stats, st)
+	}
+
+	return stats, rows.Err()
+}
+
+// History возвращает последние завершённые попытки пользователя, от новых к старым.
+func (s *Store) History(userID int64, limit int) ([]Attempt, error) {
+	rows, err := s.db.Query(`SELECT id, theme, score, total, started_at, finished_at
+		FROM attempts WHERE user_id = ? AND finished_at IS NOT NULL
+		ORDER BY finished_at DESC LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения истории пользователя %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	var attempts []Attempt
+	for rows.Next() {
+		var a Attempt
+		if err := rows.Scan(&a.ID, &a.Theme, &a.Score, &a.Total, &a.StartedAt, &a.FinishedAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения строки истории: %w", err)
+		}
+		attempts = append(attempts, a)
+	}
+
+	return attempts, rows.Err()
+}
+
+// Subscribe оформляет (или обновляет) подписку пользователя на "вопрос дня".
+func (s *Store) Subscribe(userID, chatID int64, theme string) error {
+	_, err := s.db.Exec(`INSERT INTO subscriptions (user_id, chat_id, theme, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET chat_id = excluded.chat_id, theme = excluded.theme`,
+		userID, chatID, theme, time.Now())
+	if err != nil {
+		return fmt.Errorf("ошибка оформления подписки для пользователя %d: %w", userID, err)
+	}
+	return nil
+}
+
+// Unsubscribe отменяет подписку пользователя на "вопрос дня".
+func (s *Store) Unsubscribe(userID int64) error {
+	if _, err := s.db.Exec(`DELETE FROM subscriptions WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("ошибка отмены подписки пользователя %d: %w", userID, err)
+	}
+	return nil
+}
+
+// KnownUserIDs возвращает id всех пользователей, когда-либо взаимодействовавших
+// с ботом (по состоянию, ответам или подпискам) — используется рассылкой
+// /broadcast. Предполагается, что в приватных чатах chat id совпадает с user id.
+func (s *Store) KnownUserIDs() ([]int64, error) {
+	rows, err := s.db.Query(`
+		SELECT user_id FROM user_state
+		UNION
+		SELECT user_id FROM answers
+		UNION
+		SELECT user_id FROM subscriptions`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения списка пользователей: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("ошибка чтения строки списка пользователей: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GlobalStats возвращает суммарное число правильных ответов и общее число
+// ответов по всем пользователям — используется командой /stats_global.
+func (s *Store) GlobalStats() (correct, total int, err error) {
+	row := s.db.QueryRow(`SELECT COALESCE(SUM(correct), 0), COUNT(*) FROM answers`)
+	if err := row.Scan(&correct, &total); err != nil {
+		return 0, 0, fmt.Errorf("ошибка чтения глобальной статистики: %w", err)
+	}
+	return correct, total, nil
+}
+
+// Subscribers возвращает всех пользователей, подписанных на "вопрос дня".
+func (s *Store) Subscribers() ([]Subscription, error) {
+	rows, err := s.db.Query(`SELECT user_id, chat_id, theme FROM subscriptions`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения подписок: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []Subscription
+	for rows.Next() {
+		var sub Subscription
+		if err := rows.Scan(&sub.UserID, &sub.ChatID, &sub.Theme); err != nil {
+			return nil, fmt.Errorf("ошибка чтения строки подписки: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
+
+// RecordReview обновляет запись повторения вопроса по алгоритму SM-2 на
+// основе оценки качества ответа quality (0..5) и планирует следующий показ.
+func (s *Store) RecordReview(userID int64, theme string, questionID int, quality int) error {
+	row := s.db.QueryRow(`SELECT repetitions, easiness, interval_days FROM reviews WHERE user_id = ? AND question_id = ?`,
+		userID, questionID)
+
+	repetitions := 0
+	easiness := 2.5
+	intervalDays := 0
+	if err := row.Scan(&repetitions, &easiness, &intervalDays); err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("ошибка чтения записи повторения пользователя %d: %w", userID, err)
+	}
+
+	easiness += 0.1 - float64(5-quality)*(0.08+float64(5-quality)*0.02)
+	if easiness < 1.3 {
+		easiness = 1.3
+	}
+
+	if quality < 3 {
+		repetitions = 0
+		intervalDays = 1
+	} else {
+		repetitions++
+		switch repetitions {
+		case 1:
+			intervalDays = 1
+		case 2:
+			intervalDays = 6
+		default:
+			intervalDays = int(math.Round(float64(intervalDays) * easiness))
+		}
+	}
+
+	nextDue := time.Now().AddDate(0, 0, intervalDays)
+
+	_, err := s.db.Exec(`INSERT INTO reviews (user_id, question_id, theme, repetitions, easiness, interval_days, next_due)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, question_id) DO UPDATE SET
+			theme = excluded.theme,
+			repetitions = excluded.repetitions,
+			easiness = excluded.easiness,
+			interval_days = excluded.interval_days,
+			next_due = excluded.next_due`,
+		userID, questionID, theme, repetitions, easiness, intervalDays, nextDue)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения записи повторения пользователя %d: %w", userID, err)
+	}
+
+	return nil
+}
+
+// DueItems возвращает записи повторения пользователя, срок которых уже настал,
+// от самой просроченной к менее просроченным.
+func (s *Store) DueItems(userID int64) ([]ReviewItem, error) {
+	rows, err := s.db.Query(`SELECT user_id, question_id, theme, repetitions, easiness, interval_days, next_due
+		FROM reviews WHERE user_id = ? AND next_due <= ? ORDER BY next_due ASC`, userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения вопросов к повторению пользователя %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	var items []ReviewItem
+	for rows.Next() {
+		var item ReviewItem
+		if err := rows.Scan(&item.UserID, &item.QuestionID, &item.Theme, &item.Repetitions, &item.Easiness, &item.IntervalDays, &item.NextDue); err != nil {
+			return nil, fmt.Errorf("ошибка чтения строки повторения: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// DueCounts возвращает число вопросов, которые пора повторить, по каждой теме.
+func (s *Store) DueCounts(userID int64) (map[string]int, error) {
+	rows, err := s.db.Query(`SELECT theme, COUNT(*) FROM reviews WHERE user_id = ? AND next_due <= ? GROUP BY theme`,
+		userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения статистики повторения пользователя %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var theme string
+		var count int
+		if err := rows.Scan(&theme, &count); err != nil {
+			return nil, fmt.Errorf("ошибка чтения строки статистики повторения: %w", err)
+		}
+		counts[theme] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// NextDueAfter возвращает время ближайшего будущего повторения пользователя,
+// если оно есть.
+func (s *Store) NextDueAfter(userID int64) (time.Time, bool, error) {
+	// Важно выбирать сам столбец next_due, а не MIN(next_due): у go-sqlite3
+	// перестаёт работать автоматическое преобразование в time.Time, как
+	// только столбец проходит через агрегатную функцию (теряется информация
+	// о задекларированном типе столбца), и Scan в time.Time падает с ошибкой.
+	row := s.db.QueryRow(`SELECT next_due FROM reviews WHERE user_id = ? AND next_due > ? ORDER BY next_due ASC LIMIT 1`, userID, time.Now())
+
+	var nextDue time.Time
+	if err := row.Scan(&nextDue); err != nil {
+		if err == sql.ErrNoRows {
+			return time.Time{}, false, nil
+		}
+		return time.Time{}, false, fmt.Errorf("ошибка чтения времени следующего повторения пользователя %d: %w", userID, err)
+	}
+
+	return nextDue, true, nil
+}
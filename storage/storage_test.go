@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "quizzer.db")
+	s, err := New(path)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+// reviewRow reads the raw reviews row for (userID, questionID) directly,
+// bypassing the next_due<=now filtering that DueItems/DueCounts apply, so the
+// SM-2 state transitions can be asserted precisely after each review.
+func reviewRow(t *testing.T, s *Store, userID int64, questionID int) (repetitions int, easiness float64, intervalDays int, nextDue time.Time) {
+	t.Helper()
+
+	row := s.db.QueryRow(`SELECT repetitions, easiness, interval_days, next_due FROM reviews WHERE user_id = ? AND question_id = ?`,
+		userID, questionID)
+	if err := row.Scan(&repetitions, &easiness, &intervalDays, &nextDue); err != nil {
+		t.Fatalf("reading reviews row: %v", err)
+	}
+	return repetitions, easiness, intervalDays, nextDue
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestRecordReviewCorrectSequenceGrowsInterval(t *testing.T) {
+	s := newTestStore(t)
+
+	before := time.Now()
+	if err := s.RecordReview(1, "general", 10, 5); err != nil {
+		t.Fatalf("RecordReview() error = %v", err)
+	}
+	repetitions, easiness, intervalDays, nextDue := reviewRow(t, s, 1, 10)
+	if repetitions != 1 || intervalDays != 1 || !almostEqual(easiness, 2.6) {
+		t.Fatalf("after 1st correct answer: repetitions=%d interval=%d easiness=%v, want 1, 1, 2.6", repetitions, intervalDays, easiness)
+	}
+	if !nextDue.After(before) {
+		t.Fatalf("nextDue = %v, want after %v", nextDue, before)
+	}
+
+	if err := s.RecordReview(1, "general", 10, 5); err != nil {
+		t.Fatalf("RecordReview() error = %v", err)
+	}
+	repetitions, easiness, intervalDays, _ = reviewRow(t, s, 1, 10)
+	if repetitions != 2 || intervalDays != 6 || !almostEqual(easiness, 2.7) {
+		t.Fatalf("after 2nd correct answer: repetitions=%d interval=%d easiness=%v, want 2, 6, 2.7", repetitions, intervalDays, easiness)
+	}
+
+	if err := s.RecordReview(1, "general", 10, 5); err != nil {
+		t.Fatalf("RecordReview() error = %v", err)
+	}
+	repetitions, easiness, intervalDays, _ = reviewRow(t, s, 1, 10)
+	// Интервал на 3-м повторении считается как round(предыдущий_интервал *
+	// НОВАЯ easiness), а не старая — поэтому ожидание строится от обновлённого
+	// значения easiness (2.7 + 0.1 = 2.8), а не от значения до этого вызова.
+	wantInterval := int(math.Round(6 * 2.8))
+	if repetitions != 3 || intervalDays != wantInterval || !almostEqual(easiness, 2.8) {
+		t.Fatalf("after 3rd correct answer: repetitions=%d interval=%d easiness=%v, want 3, %d, 2.8", repetitions, intervalDays, easiness, wantInterval)
+	}
+}
+
+func TestRecordReviewWrongAnswerResetsRepetitions(t *testing.T) {
+	s := newTestStore(t)
+
+	if err := s.RecordReview(1, "general", 10, 5); err != nil {
+		t.Fatalf("RecordReview() error = %v", err)
+	}
+	if err := s.RecordReview(1, "general", 10, 5); err != nil {
+		t.Fatalf("RecordReview() error = %v", err)
+	}
+
+	if err := s.RecordReview(1, "general", 10, 2); err != nil {
+		t.Fatalf("RecordReview() error = %v", err)
+	}
+
+	repetitions, easiness, intervalDays, _ := reviewRow(t, s, 1, 10)
+	if repetitions != 0 || intervalDays != 1 {
+		t.Fatalf("after a wrong answer: repetitions=%d interval=%d, want 0, 1", repetitions, intervalDays)
+	}
+	if easiness >= 2.7 {
+		t.Fatalf("easiness = %v, want it to have decreased after a wrong answer", easiness)
+	}
+}
+
+func TestRecordReviewEasinessFloor(t *testing.T) {
+	s := newTestStore(t)
+
+	for i := 0; i < 20; i++ {
+		if err := s.RecordReview(1, "general", 10, 2); err != nil {
+			t.Fatalf("RecordReview() error = %v", err)
+		}
+	}
+
+	_, easiness, _, _ := reviewRow(t, s, 1, 10)
+	if easiness < 1.3 {
+		t.Fatalf("easiness = %v, must never drop below the SM-2 floor of 1.3", easiness)
+	}
+}
+
+func TestDueItemsAndCounts(t *testing.T) {
+	s := newTestStore(t)
+
+	if err := s.RecordReview(1, "general", 10, 2); err != nil {
+		t.Fatalf("RecordReview() error = %v", err)
+	}
+	if err := s.RecordReview(1, "general", 11, 5); err != nil {
+		t.Fatalf("RecordReview() error = %v", err)
+	}
+
+	// RecordReview всегда планирует следующий показ в будущем, поэтому для
+	// проверки DueItems/DueCounts искусственно переводим один из вопросов в
+	// прошлое напрямую через схему (чтение/запись reviews за пределами
+	// публичного API — допустимо для white-box теста в том же пакете).
+	if _, err := s.db.Exec(`UPDATE reviews SET next_due = ? WHERE user_id = ? AND question_id = ?`,
+		time.Now().Add(-time.Hour), 1, 10); err != nil {
+		t.Fatalf("failed to backdate next_due: %v", err)
+	}
+
+	due, err := s.DueItems(1)
+	if err != nil {
+		t.Fatalf("DueItems() error = %v", err)
+	}
+	if len(due) != 1 || due[0].QuestionID != 10 {
+		t.Fatalf("DueItems() = %+v, want exactly question 10", due)
+	}
+
+	counts, err := s.DueCounts(1)
+	if err != nil {
+		t.Fatalf("DueCounts() error = %v", err)
+	}
+	if counts["general"] != 1 {
+		t.Fatalf("DueCounts()[\"general\"] = %d, want 1", counts["general"])
+	}
+
+	nextDue, hasNext, err := s.NextDueAfter(1)
+	if err != nil {
+		t.Fatalf("NextDueAfter() error = %v", err)
+	}
+	if !hasNext {
+		t.Fatal("NextDueAfter() hasNext = false, want true (question 11 is still scheduled in the future)")
+	}
+	if !nextDue.After(time.Now()) {
+		t.Fatalf("NextDueAfter() = %v, want a time in the future", nextDue)
+	}
+}